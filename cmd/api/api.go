@@ -10,6 +10,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/robertgouveia/social/docs"
 	"github.com/robertgouveia/social/internal/auth"
+	"github.com/robertgouveia/social/internal/blob"
 	"github.com/robertgouveia/social/internal/mail"
 	"github.com/robertgouveia/social/internal/store"
 	"github.com/robertgouveia/social/internal/store/cache"
@@ -25,17 +26,36 @@ type application struct {
 	mailer        *mail.MailHog
 	authenticator auth.Authenticator
 	cacheStorage  cache.Storage
+	blobStore     blob.BlobStore
+	mediaWake     chan struct{} // nudges the media worker after an upload
 }
 
 type authConfig struct {
 	basic basicConfig
 	token tokenConfig
+	login loginConfig
+}
+
+// brute force protection, failures are tracked per account and per ip
+type loginConfig struct {
+	freeAttempts       int // failures before delays start
+	baseDelay          time.Duration
+	maxDelay           time.Duration
+	maxAccountFailures int
+	maxIPFailures      int
+	lockout            time.Duration
 }
 
 type tokenConfig struct {
-	secret string
-	exp    time.Duration
-	iss    string
+	secret     string
+	keyFile    string // PEM private key, switches signing from HS256 to RS256 / EdDSA
+	kid        string
+	verifyKeys string // comma separated public key files ([kid=]path) still accepted after a rotation
+	exp        time.Duration
+	refreshExp time.Duration
+	iss        string
+	// how often expired entries are removed from the postgres revocation list
+	revocationPurge time.Duration
 }
 
 type basicConfig struct {
@@ -59,6 +79,54 @@ type config struct {
 	frontendURL string
 	auth        authConfig
 	redisCfg    redisCfg
+	pagination  paginationConfig
+	feed        feedConfig
+	explore     exploreConfig
+	publisher   publisherConfig
+	trash       trashConfig
+	media       mediaConfig
+}
+
+type mediaConfig struct {
+	backend   string // local or s3
+	dir       string // where the local backend keeps files
+	s3        blob.S3Config
+	maxSize   int64 // per file, in bytes
+	maxFiles  int   // per post
+	urlSecret string
+	urlExp    time.Duration // how long signed download urls work
+	// image processing
+	workerInterval time.Duration
+	workerBatch    int
+	claimTimeout   time.Duration // how long before an unfinished claim is handed to another worker
+}
+
+type trashConfig struct {
+	retention     time.Duration // how long deleted posts can be restored before they're purged
+	purgeInterval time.Duration
+	batchSize     int
+}
+
+type publisherConfig struct {
+	interval  time.Duration // how often scheduled posts are checked
+	batchSize int
+}
+
+type exploreConfig struct {
+	window         time.Duration // how far back explore looks for posts
+	size           int           // posts ranked and cached, the most explore can page through
+	trendingWindow time.Duration
+	trendingSize   int
+	refresh        time.Duration
+}
+
+type feedConfig struct {
+	// authors with more followers than this aren't fanned out to cached timelines
+	fanOutLimit int
+}
+
+type paginationConfig struct {
+	cursorSecret string // signs feed cursors so clients can't forge them
 }
 
 type redisCfg struct {
@@ -70,6 +138,7 @@ type redisCfg struct {
 
 type mailConfig struct {
 	exp       time.Duration
+	resetExp  time.Duration
 	fromEmail string
 	sendGrid  sendGridConfig
 }
@@ -85,7 +154,7 @@ func (app *application) mount() *chi.Mux {
 		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
@@ -99,6 +168,9 @@ func (app *application) mount() *chi.Mux {
 
 	r.Route("/v1", func(r chi.Router) {
 		r.With(app.BasicAuthMiddleware()).Get("/health", app.healthCheckHandler)
+		r.Get("/.well-known/jwks.json", app.jwksHandler)
+		// signed urls, the signature stands in for authentication
+		r.Get("/attachments/{attachmentID}", app.downloadAttachmentHandler)
 
 		// multiple documents, configuration
 		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
@@ -106,36 +178,130 @@ func (app *application) mount() *chi.Mux {
 
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.scopeMiddleware("posts"))
 			r.Post("/", app.createPostHandler)
+			r.Get("/drafts", app.getDraftsHandler)
+			r.Get("/trash", app.getTrashHandler)
+			r.Put("/trash/{postID}/restore", app.restorePostHandler)
 
 			r.Route("/{postID}", func(r chi.Router) {
 				r.Use(app.postsContextMiddleware)
 
 				r.Get("/", app.checkPostOwnership("moderator", app.getPostHandler))
 				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
-				r.Patch("/", app.updatePostHandler)
+				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+				r.Put("/publish", app.publishPostHandler)
+
+				r.Post("/attachments", app.uploadAttachmentsHandler)
+				r.Delete("/attachments/{attachmentID}", app.deleteAttachmentHandler)
+
+				r.Route("/revisions", func(r chi.Router) {
+					r.Get("/", app.checkPostOwnership("moderator", app.getPostRevisionsHandler))
+					r.Get("/diff", app.checkPostOwnership("moderator", app.diffPostRevisionsHandler))
+					r.Get("/{version}", app.checkPostOwnership("moderator", app.getPostRevisionHandler))
+					r.Put("/{version}/restore", app.checkPostOwnership("moderator", app.restorePostRevisionHandler))
+				})
+
+				r.Put("/reactions/{kind}", app.addReactionHandler)
+				r.Delete("/reactions/{kind}", app.removeReactionHandler)
+
+				r.Route("/comments", func(r chi.Router) {
+					r.Get("/", app.getCommentsHandler)
+					r.Post("/", app.createCommentHandler)
+
+					r.Route("/{commentID}", func(r chi.Router) {
+						r.Use(app.commentsContextMiddleware)
+
+						r.Get("/replies", app.getCommentRepliesHandler)
+						r.Patch("/", app.checkCommentOwnership("moderator", app.updateCommentHandler))
+						r.Delete("/", app.checkCommentOwnership("moderator", app.deleteCommentHandler))
+					})
+				})
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
 
-			r.With(app.AuthTokenMiddleware).Route("/{userID}", func(r chi.Router) {
+			r.With(app.AuthTokenMiddleware, app.scopeMiddleware("users")).Route("/{userID}", func(r chi.Router) {
 				r.Get("/", app.getUserHandler)
+				r.Get("/posts", app.getUserPostsHandler)
+				r.Get("/followers", app.getFollowersHandler)
+				r.Get("/following", app.getFollowingHandler)
 
 				r.Put("/follow", app.followUserHandler)
 				r.Put("/unfollow", app.unfollowUserHandler)
+
+				r.Put("/block", app.blockUserHandler)
+				r.Delete("/block", app.unblockUserHandler)
+				r.Put("/mute", app.muteUserHandler)
+				r.Delete("/mute", app.unmuteUserHandler)
 			})
 
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.scopeMiddleware("posts"))
 				r.Get("/feed", app.getUserFeedHandler)
 			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.scopeMiddleware("users"))
+				r.Put("/privacy", app.setPrivacyHandler)
+				r.Get("/follow-requests", app.getFollowRequestsHandler)
+				r.Put("/follow-requests/{requesterID}", app.approveFollowRequestHandler)
+				r.Delete("/follow-requests/{requesterID}", app.rejectFollowRequestHandler)
+				r.Get("/blocks", app.getBlocksHandler)
+				r.Get("/mutes", app.getMutesHandler)
+			})
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.scopeMiddleware("posts"))
+			r.Get("/explore", app.getExploreHandler)
+			r.Get("/tags/trending", app.getTrendingTagsHandler)
+		})
+
+		r.Route("/search", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.With(app.scopeMiddleware("posts")).Get("/", app.searchPostsHandler)
+			r.With(app.scopeMiddleware("users")).Get("/users", app.searchUsersHandler)
 		})
 
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.Post("/password/forgot", app.forgotPasswordHandler)
+			r.Post("/password/reset", app.resetPasswordHandler)
+
+			r.Post("/mfa/verify", app.verifyMFAHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.sessionOnlyMiddleware)
+				r.Post("/logout", app.logoutHandler)
+				r.Post("/logout/all", app.logoutAllHandler)
+
+				r.Post("/mfa/enroll", app.enrollMFAHandler)
+				r.Post("/mfa/enable", app.enableMFAHandler)
+				r.Post("/mfa/disable", app.disableMFAHandler)
+			})
+		})
+
+		r.Route("/roles", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.sessionOnlyMiddleware)
+			r.Put("/{role}/mfa", app.checkRole("admin", app.setRoleMFAHandler))
+		})
+
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.sessionOnlyMiddleware)
+			r.Get("/", app.getAPIKeysHandler)
+			r.Post("/", app.createAPIKeyHandler)
+			r.Delete("/{keyID}", app.revokeAPIKeyHandler)
 		})
 	})
 
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robertgouveia/social/internal/auth"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+const (
+	apiKeyPrefix     = "gs_"
+	apiKeyPrefixLen  = 11 // gs_ and the first 8 characters of the key
+	apiKeyDefaultExp = 90 // days
+)
+
+type apiKeyKey string
+
+const apiKeyCtx apiKeyKey = "apiKey"
+
+type CreateAPIKeyPayload struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write users:read users:write"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,gte=1,lte=365"`
+}
+
+type APIKeyWithSecret struct {
+	store.APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKey godoc
+//
+//	@Summary		Creates an API key
+//	@Description	Creates a scoped, expiring API key, the key is only returned once
+//	@Tags			api-keys
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateAPIKeyPayload	true	"API key"
+//	@Success		201		{object}	APIKeyWithSecret
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/api-keys [post]
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateAPIKeyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if payload.ExpiresInDays == 0 {
+		payload.ExpiresInDays = apiKeyDefaultExp
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	plainKey := apiKeyPrefix + token
+
+	user := getUserFromContext(r)
+
+	key := &store.APIKey{
+		UserID: user.ID,
+		Name:   payload.Name,
+		Prefix: plainKey[:apiKeyPrefixLen],
+		Key:    auth.HashToken(plainKey),
+		Scopes: payload.Scopes,
+		Expiry: time.Now().Add(time.Hour * 24 * time.Duration(payload.ExpiresInDays)),
+	}
+
+	if err := app.store.APIKeys.Create(r.Context(), key); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, &APIKeyWithSecret{APIKey: *key, Key: plainKey}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetAPIKeys godoc
+//
+//	@Summary		Lists API keys
+//	@Description	Lists the current users API keys, including revoked and expired keys
+//	@Tags			api-keys
+//	@Produce		json
+//	@Success		200	{array}		store.APIKey
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/api-keys [get]
+func (app *application) getAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	keys, err := app.store.APIKeys.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, keys); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// RevokeAPIKey godoc
+//
+//	@Summary		Revokes an API key
+//	@Description	Revokes one of the current users API keys by ID
+//	@Tags			api-keys
+//	@Produce		json
+//	@Param			id	path	int	true	"API key ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/api-keys/{id} [delete]
+func (app *application) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.APIKeys.Revoke(r.Context(), keyID, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func getAPIKeyFromContext(r *http.Request) *store.APIKey {
+	key, _ := r.Context().Value(apiKeyCtx).(*store.APIKey)
+	return key
+}
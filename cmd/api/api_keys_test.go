@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertgouveia/social/internal/auth"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+const readOnlyAPIKey = "sk_test_read_only"
+
+// readOnlyAPIKeyStore only knows readOnlyAPIKey, which user 42 created with posts:read
+type readOnlyAPIKeyStore struct {
+	store.MockAPIKeyStore
+}
+
+func (s *readOnlyAPIKeyStore) GetByKey(ctx context.Context, hash string) (*store.APIKey, error) {
+	if hash != auth.HashToken(readOnlyAPIKey) {
+		return nil, store.ErrNotFound
+	}
+
+	return &store.APIKey{ID: 1, UserID: 42, Scopes: []string{"posts:read"}, Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	app := newTestApplication(t)
+	app.store.APIKeys = &readOnlyAPIKeyStore{}
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(t *testing.T, method, path, authorization string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(method, path, strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", authorization)
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("Should reject an unknown api key", func(t *testing.T) {
+		checkResponseCode(t, http.StatusUnauthorized, request(t, http.MethodGet, "/v1/explore", "ApiKey sk_test_unknown"))
+	})
+
+	t.Run("Should allow reads within the keys scopes", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodGet, "/v1/explore", "ApiKey "+readOnlyAPIKey))
+	})
+
+	t.Run("Should forbid writes a read scope doesn't cover", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodPost, "/v1/posts", "ApiKey "+readOnlyAPIKey))
+	})
+
+	t.Run("Should forbid reads of other resources", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodGet, "/v1/users/1", "ApiKey "+readOnlyAPIKey))
+	})
+
+	t.Run("Should keep api keys away from account management", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodGet, "/v1/api-keys", "ApiKey "+readOnlyAPIKey))
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodPost, "/v1/api-keys", "ApiKey "+readOnlyAPIKey))
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodPost, "/v1/authentication/logout", "ApiKey "+readOnlyAPIKey))
+	})
+
+	t.Run("Should give logged in sessions every scope", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodGet, "/v1/api-keys", "Bearer "+testToken))
+	})
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/robertgouveia/social/internal/blob"
+	"github.com/robertgouveia/social/internal/media"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// allowedMediaTypes are the types uploads may sniff as, the type the client claims is ignored.
+// Images are limited to what the media worker can decode, anything else would keep its EXIF data
+var allowedMediaTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"application/pdf": true,
+}
+
+var (
+	errFileTooLarge     = errors.New("file is too large")
+	errUnsupportedMedia = errors.New("file type is not supported")
+)
+
+// UploadAttachments godoc
+//
+//	@Summary		Uploads attachments to a post
+//	@Description	Uploads one or more files as multipart/form-data, each in a "file" field. JPEG, PNG and GIF images and PDFs only. Either every file is added or none
+//	@Tags			posts
+//	@Accept			mpfd
+//	@Produce		json
+//	@Param			id		path		int		true	"Post ID"
+//	@Param			file	formData	file	true	"File"
+//	@Success		201		{array}		store.Attachment
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		413		{object}	error
+//	@Failure		415		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/attachments [post]
+func (app *application) uploadAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	if post.UserID != user.ID {
+		app.forbidden(w, r, errors.New("only the author can add attachments"))
+		return
+	}
+
+	ctx := r.Context()
+	existing, err := app.store.Attachments.GetByPostID(ctx, post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// room for every file the post can still take, plus the multipart framing
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.media.maxSize*int64(app.config.media.maxFiles)+1<<20)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	// files are put in the blob store as they are read and only added to the post once every
+	// one of them is accepted, a rejected request leaves nothing behind
+	uploaded := []*store.Attachment{}
+	committed := false
+	defer func() {
+		if !committed {
+			app.deleteBlobs(attachmentKeys(uploaded)...)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				app.payloadTooLarge(w, r, errFileTooLarge)
+				return
+			}
+			app.badRequest(w, r, err)
+			return
+		}
+
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		if len(existing)+len(uploaded) >= app.config.media.maxFiles {
+			part.Close()
+			app.badRequest(w, r, fmt.Errorf("a post can have at most %d attachments", app.config.media.maxFiles))
+			return
+		}
+
+		attachment, err := app.putAttachment(ctx, post.ID, user.ID, part)
+		part.Close()
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.Is(err, errFileTooLarge), errors.As(err, &maxBytesErr):
+				app.payloadTooLarge(w, r, errFileTooLarge)
+			case errors.Is(err, errUnsupportedMedia):
+				app.unsupportedMediaType(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		uploaded = append(uploaded, attachment)
+	}
+
+	if len(uploaded) == 0 {
+		app.badRequest(w, r, errors.New("no files were uploaded"))
+		return
+	}
+
+	// the count above can race with another upload, the store checks it again under a lock
+	if err := app.store.Attachments.Create(ctx, app.config.media.maxFiles, uploaded...); err != nil {
+		switch {
+		case errors.Is(err, store.ErrTooManyAttachments):
+			app.badRequest(w, r, fmt.Errorf("a post can have at most %d attachments", app.config.media.maxFiles))
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	committed = true
+
+	app.wakeMediaWorker()
+
+	attachments := make([]store.Attachment, len(uploaded))
+	for i, a := range uploaded {
+		attachments[i] = *a
+	}
+
+	app.signAttachments(attachments)
+
+	if err := app.jsonResponse(w, http.StatusCreated, attachments); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// putAttachment reads an uploaded file, checks its size and sniffed type, then puts it in the blob
+// store. The attachment isn't saved, the caller creates it or deletes the blob
+func (app *application) putAttachment(ctx context.Context, postID, userID int64, part *multipart.Part) (*store.Attachment, error) {
+	maxSize := app.config.media.maxSize
+
+	data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, errFileTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedMediaTypes[contentType] {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedMedia, contentType)
+	}
+
+	filename := filepath.Base(part.FileName())
+	if len(filename) > 255 {
+		filename = filename[len(filename)-255:]
+	}
+
+	attachment := &store.Attachment{
+		PostID:      postID,
+		UserID:      userID,
+		Key:         fmt.Sprintf("posts/%d/%s", postID, uuid.New().String()),
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Status:      store.AttachmentReady,
+	}
+
+	// images are held back until the media worker has stripped them
+	if media.CanProcess(contentType) {
+		attachment.Status = store.AttachmentPending
+	}
+
+	if err := app.blobStore.Put(ctx, attachment.Key, bytes.NewReader(data), attachment.Size, contentType); err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+func attachmentKeys(attachments []*store.Attachment) []string {
+	keys := make([]string, len(attachments))
+	for i, a := range attachments {
+		keys[i] = a.Key
+	}
+	return keys
+}
+
+// DeleteAttachment godoc
+//
+//	@Summary		Deletes an attachment
+//	@Description	Removes an attachment from a post
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path	int	true	"Post ID"
+//	@Param			attachmentID	path	int	true	"Attachment ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/attachments/{attachmentID} [delete]
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	if post.UserID != getUserFromContext(r).ID {
+		app.forbidden(w, r, errors.New("only the author can remove attachments"))
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "attachmentID"), 10, 64)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	attachment, err := app.store.Attachments.GetByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the attachment has to belong to the post in the url
+	if attachment.PostID != post.ID {
+		app.notFound(w, r, store.ErrNotFound)
+		return
+	}
+
+	keys, err := app.store.Attachments.Delete(ctx, attachment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.deleteBlobs(keys...)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DownloadAttachment godoc
+//
+//	@Summary		Downloads an attachment
+//	@Description	Serves an attachment from a signed url, the urls are handed out with posts and expire. Images are only served once they're processed
+//	@Tags			posts
+//	@Produce		octet-stream
+//	@Param			attachmentID	path	int		true	"Attachment ID"
+//	@Param			expires			query	int		true	"Expiry, unix seconds"
+//	@Param			sig				query	string	true	"Signature"
+//	@Param			size			query	string	false	"Rendition, thumbnail or medium"
+//	@Success		200
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/attachments/{attachmentID} [get]
+func (app *application) downloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "attachmentID"), 10, 64)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	qs := r.URL.Query()
+	expires, err := strconv.ParseInt(qs.Get("expires"), 10, 64)
+	if err != nil || !app.validAttachmentSignature(id, expires, qs.Get("sig")) {
+		app.forbidden(w, r, errors.New("invalid attachment signature"))
+		return
+	}
+
+	if time.Now().Unix() > expires {
+		app.forbidden(w, r, errors.New("attachment url has expired"))
+		return
+	}
+
+	ctx := r.Context()
+	attachment, err := app.store.Attachments.GetByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// pending images may still carry their EXIF data, failed ones always will
+	if attachment.Status != store.AttachmentReady {
+		app.conflict(w, r, fmt.Errorf("attachment is %s", attachment.Status))
+		return
+	}
+
+	key, contentType, size := attachment.Key, attachment.ContentType, attachment.Size
+	switch name := qs.Get("size"); name {
+	case "":
+	case "thumbnail", "medium":
+		// images that are already small don't have renditions, their urls are only signed for the original
+		rendition, err := app.store.Attachments.GetRendition(ctx, attachment.ID, name)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFound(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		key, contentType, size = rendition.Key, rendition.ContentType, rendition.Size
+	default:
+		app.badRequest(w, r, fmt.Errorf("unknown size %q", name))
+		return
+	}
+
+	body, err := app.blobStore.Get(ctx, key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer body.Close()
+
+	// only images are shown inline, anything else is downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(time.Until(time.Unix(expires, 0)).Seconds())))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, body); err != nil {
+		app.logger.Errorw("error streaming attachment", "attachment_id", attachment.ID, "error", err)
+	}
+}
+
+// loadAttachments fills in the signed attachments of a list of posts with one query
+func (app *application) loadAttachments(ctx context.Context, posts []store.PostWithMetaData) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	attachments, err := app.store.Attachments.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	app.signAttachments(attachments)
+
+	byPost := make(map[int64][]store.Attachment, len(posts))
+	for _, a := range attachments {
+		byPost[a.PostID] = append(byPost[a.PostID], a)
+	}
+
+	for i := range posts {
+		posts[i].Attachments = byPost[posts[i].ID]
+		if posts[i].Attachments == nil {
+			posts[i].Attachments = []store.Attachment{}
+		}
+	}
+
+	return nil
+}
+
+// signAttachments fills in the download urls, they're relative to the api host
+func (app *application) signAttachments(attachments []store.Attachment) {
+	expires := time.Now().Add(app.config.media.urlExp).Unix()
+	for i := range attachments {
+		a := &attachments[i]
+		a.URL = fmt.Sprintf("/v1/attachments/%d?expires=%d&sig=%s", a.ID, expires, app.attachmentSignature(a.ID, expires))
+
+		for name, rendition := range a.Renditions {
+			rendition.URL = a.URL + "&size=" + name
+			a.Renditions[name] = rendition
+		}
+	}
+}
+
+func (app *application) attachmentSignature(id, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(app.config.media.urlSecret))
+	fmt.Fprintf(mac, "%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (app *application) validAttachmentSignature(id, expires int64, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(app.attachmentSignature(id, expires)))
+}
+
+// deleteBlobs removes blobs whose rows are already gone, failures are only logged
+func (app *application) deleteBlobs(keys ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	for _, key := range keys {
+		if err := app.blobStore.Delete(ctx, key); err != nil {
+			app.logger.Errorw("error deleting blob", "key", key, "error", err)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertgouveia/social/internal/blob"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// readyAttachmentStore every attachment is a processed image too small for renditions
+type readyAttachmentStore struct {
+	store.MockAttachmentStore
+}
+
+func (s *readyAttachmentStore) GetByID(ctx context.Context, id int64) (*store.Attachment, error) {
+	return &store.Attachment{ID: id, Key: "posts/1/image", ContentType: "image/png", Status: store.AttachmentReady, Renditions: map[string]store.AttachmentRendition{}}, nil
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.media.urlSecret = "test"
+	mux := app.mount()
+
+	t.Run("Should reject a forged signature", func(t *testing.T) {
+		expires := time.Now().Add(time.Minute).Unix()
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/v1/attachments/1?expires=%d&sig=forged", expires), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Should 404 a size the attachment has no rendition for", func(t *testing.T) {
+		app.store.Attachments = &readyAttachmentStore{}
+		defer func() { app.store.Attachments = &store.MockAttachmentStore{} }()
+
+		expires := time.Now().Add(time.Minute).Unix()
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/v1/attachments/1?expires=%d&sig=%s&size=thumbnail", expires, app.attachmentSignature(1, expires)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Should reject an expired url", func(t *testing.T) {
+		expires := time.Now().Add(-time.Minute).Unix()
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/v1/attachments/1?expires=%d&sig=%s", expires, app.attachmentSignature(1, expires)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+// listedPostStore lists posts 3 and 4 as a users posts
+type listedPostStore struct {
+	store.MockPostStore
+}
+
+func (s *listedPostStore) GetByUserID(ctx context.Context, userID, viewerID int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetaData, error) {
+	return []store.PostWithMetaData{
+		{Post: store.Post{ID: 3, UserID: userID, CreatedAt: time.Now().Format(time.RFC3339)}},
+		{Post: store.Post{ID: 4, UserID: userID, CreatedAt: time.Now().Format(time.RFC3339)}},
+	}, nil
+}
+
+// listedAttachmentStore only post 3 has an attachment
+type listedAttachmentStore struct {
+	store.MockAttachmentStore
+}
+
+func (s *listedAttachmentStore) GetByPostIDs(ctx context.Context, postIDs []int64) ([]store.Attachment, error) {
+	return []store.Attachment{{ID: 10, PostID: 3, Status: store.AttachmentReady, Renditions: map[string]store.AttachmentRendition{}}}, nil
+}
+
+func TestListedPostAttachments(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.media.urlSecret = "test"
+	app.config.media.urlExp = time.Minute
+	app.store.Posts = &listedPostStore{}
+	app.store.Attachments = &listedAttachmentStore{}
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/9/posts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var body struct {
+		Data []store.PostWithMetaData `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Data) != 2 {
+		t.Fatalf("Expected 2 posts, got %d", len(body.Data))
+	}
+
+	if a := body.Data[0].Attachments; len(a) != 1 || !strings.HasPrefix(a[0].URL, "/v1/attachments/10?expires=") {
+		t.Errorf("Expected post 3 to have a signed attachment, got %+v", a)
+	}
+
+	if a := body.Data[1].Attachments; a == nil || len(a) != 0 {
+		t.Errorf("Expected post 4 to have no attachments, got %+v", a)
+	}
+}
+
+// webpWithExif builds a WebP container holding an EXIF chunk with a GPS tag, enough to sniff as image/webp
+func webpWithExif() []byte {
+	chunk := func(fourCC string, data []byte) []byte {
+		b := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+		b = append(b, data...)
+		if len(data)%2 == 1 {
+			b = append(b, 0)
+		}
+		return b
+	}
+
+	// little endian TIFF with one IFD entry, the GPS info pointer
+	exif := []byte("II*\x00\x08\x00\x00\x00\x01\x00\x25\x88\x04\x00\x01\x00\x00\x00\x1a\x00\x00\x00\x00\x00\x00\x00")
+
+	// VP8X with the EXIF flag set and a 1x1 canvas
+	body := append([]byte("WEBP"), chunk("VP8X", []byte{0x08, 0, 0, 0, 0, 0, 0, 0, 0, 0})...)
+	body = append(body, chunk("EXIF", exif)...)
+
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+// countingAttachmentStore holds the posts attachments in memory and enforces the limit like the database
+type countingAttachmentStore struct {
+	store.MockAttachmentStore
+	created []*store.Attachment
+}
+
+func (s *countingAttachmentStore) Create(ctx context.Context, limit int, attachments ...*store.Attachment) error {
+	if len(s.created)+len(attachments) > limit {
+		return store.ErrTooManyAttachments
+	}
+
+	s.created = append(s.created, attachments...)
+	return nil
+}
+
+// countBlobs counts the files a local blob store holds under dir
+func countBlobs(t *testing.T, dir string) int {
+	t.Helper()
+
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestUploadAttachment(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.media.maxSize = 1 << 20
+	app.config.media.maxFiles = 4
+	app.store.Posts = &publicPostStore{}
+	attachments := &countingAttachmentStore{}
+	app.store.Attachments = attachments
+	blobDir := t.TempDir()
+	blobStore, err := blob.NewLocalStore(blobDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.blobStore = blobStore
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	png := []byte("\x89PNG\r\n\x1a\n")
+
+	upload := func(t *testing.T, files ...[]byte) int {
+		t.Helper()
+
+		var buf bytes.Buffer
+		form := multipart.NewWriter(&buf)
+		for i, file := range files {
+			part, err := form.CreateFormFile("file", fmt.Sprintf("file-%d", i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := part.Write(file); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := form.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// post 1 belongs to the test user
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts/1/attachments", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("Should reject a WebP the media worker can't strip", func(t *testing.T) {
+		webp := webpWithExif()
+		if sniffed := http.DetectContentType(webp); sniffed != "image/webp" {
+			t.Fatalf("Expected the file to sniff as image/webp, got %s", sniffed)
+		}
+
+		checkResponseCode(t, http.StatusUnsupportedMediaType, upload(t, webp))
+	})
+
+	t.Run("Should keep none of the files when a later one is rejected", func(t *testing.T) {
+		checkResponseCode(t, http.StatusUnsupportedMediaType, upload(t, png, png, webpWithExif()))
+
+		if len(attachments.created) != 0 {
+			t.Errorf("Expected no attachments to be created, got %d", len(attachments.created))
+		}
+
+		if n := countBlobs(t, blobDir); n != 0 {
+			t.Errorf("Expected the stored files to be deleted, %d are left", n)
+		}
+	})
+
+	t.Run("Should add every file of an accepted upload", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, upload(t, png, png, png))
+
+		if len(attachments.created) != 3 {
+			t.Errorf("Expected 3 attachments to be created, got %d", len(attachments.created))
+		}
+
+		if n := countBlobs(t, blobDir); n != 3 {
+			t.Errorf("Expected 3 stored files, got %d", n)
+		}
+	})
+
+	t.Run("Should delete the files when the store refuses them over the limit", func(t *testing.T) {
+		// the handler saw no attachments, as if a concurrent upload filled the post after it looked
+		checkResponseCode(t, http.StatusBadRequest, upload(t, png, png))
+
+		if len(attachments.created) != 3 {
+			t.Errorf("Expected the 3 earlier attachments only, got %d", len(attachments.created))
+		}
+
+		if n := countBlobs(t, blobDir); n != 3 {
+			t.Errorf("Expected the 3 earlier files only, got %d", n)
+		}
+	})
+}
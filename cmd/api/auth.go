@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/robertgouveia/social/internal/auth"
 	"github.com/robertgouveia/social/internal/mail"
 	"github.com/robertgouveia/social/internal/store"
 )
@@ -24,6 +28,44 @@ type RegisterUserPayload struct {
 	Password string `json:"password" validate:"required,min=3,max=72"`
 }
 
+type refreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required,max=255"`
+}
+
+type logoutPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"omitempty,max=255"`
+}
+
+type forgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type resetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+const accessTokenType = "access"
+
+// dummyUser is compared against when the email doesn't exist
+var dummyUser = func() *store.User {
+	user := &store.User{}
+	_ = user.Password.Set(uuid.New().String())
+	return user
+}()
+
+type claimsKey string
+
+const claimsCtx claimsKey = "claims"
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds until the access token expires
+	// the users role requires two factor authentication but they have not enrolled yet
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+}
+
 type UserWithToken struct {
 	store.User
 	Token string `json:"token"`
@@ -124,9 +166,132 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		app.badRequest(w, r, err)
 		return
 	}
+	ctx := r.Context()
+
+	// throttle before touching the credentials
+	accountKey, ipKey, ipAddress := loginThrottleKeys(payload.Email, r)
+	retryAfter, reservation, err := app.reserveLoginAttempt(ctx, accountKey, ipKey)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.tooManyRequests(w, r, retryAfter)
+		return
+	}
+
 	// fetch the user (check if the user exists)
-	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if user == nil {
+		// compare anyway so unknown emails take as long as wrong passwords
+		_ = dummyUser.Password.Compare(payload.Password)
+	}
+
+	if user == nil || user.Password.Compare(payload.Password) != nil {
+		app.loginFailed(user, reservation, ipAddress)
+		app.unauthorized(w, r, fmt.Errorf("invalid credentials"))
+		return
+	}
+
+	if err := app.loginSucceeded(ctx, reservation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// accounts with two factor authentication get a challenge instead of tokens
+	mfa, err := app.store.MFA.Get(ctx, user.ID)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if mfa != nil && mfa.Enabled {
+		challenge, err := app.generateMFAChallenge(user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if err := app.jsonResponse(w, http.StatusAccepted, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// generate the access token and start a refresh token family
+	tokens, err := app.issueTokens(ctx, user.ID, false)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	tokens.MFAEnrollmentRequired = user.Role.RequireMFA
+
+	// send to the client
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// RefreshToken godoc
+//
+//	@Summary		Refreshes an access token
+//	@Description	Exchanges a refresh token for a new access and refresh token pair
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		refreshTokenPayload	true	"Refresh token"
+//	@Success		201		{object}	tokenResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload refreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	plainToken, err := auth.GenerateOpaqueToken()
 	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// rotation: the presented token is spent and replaced by the next one
+	next := &store.RefreshToken{
+		Token:  auth.HashToken(plainToken),
+		Expiry: time.Now().Add(app.config.auth.token.refreshExp),
+	}
+	if err := app.store.RefreshTokens.Rotate(ctx, auth.HashToken(payload.RefreshToken), next); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorized(w, r, err)
+		case store.ErrTokenReused:
+			app.logger.Warnw("refresh token reuse detected, token family revoked", "user_id", next.UserID, "family_id", next.FamilyID)
+			app.unauthorized(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the user may have been removed since the token was issued
+	if _, err := app.store.Users.GetByID(ctx, next.UserID); err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.unauthorized(w, r, err)
@@ -135,24 +300,322 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
+
+	accessToken, err := app.generateAccessToken(next.UserID, next.MFA)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens := &tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: plainToken,
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// issueTokens starts a new refresh token family for a fresh login,
+// mfa records whether the login passed a second factor
+func (app *application) issueTokens(ctx context.Context, userID int64, mfa bool) (*tokenResponse, error) {
+	accessToken, err := app.generateAccessToken(userID, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	plainToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := &store.RefreshToken{
+		Token:    auth.HashToken(plainToken),
+		UserID:   userID,
+		FamilyID: uuid.New().String(),
+		MFA:      mfa,
+		Expiry:   time.Now().Add(app.config.auth.token.refreshExp),
+	}
+	if err := app.store.RefreshTokens.Create(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: plainToken,
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}, nil
+}
+
+// issuedAt is a NumericDate with microseconds, whole seconds can't tell a token issued just after
+// logging out everywhere from one issued just before
+func issuedAt(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+func (app *application) generateAccessToken(userID int64, mfa bool) (string, error) {
 	// generate the token -> add claims
 	claims := jwt.MapClaims{
-		"sub": user.ID, // subject
+		"sub": userID, // subject
 		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
-		"iat": time.Now().Unix(), //issued at
-		"nbf": time.Now().Unix(), //not before
+		"iat": issuedAt(time.Now()), //issued at
+		"nbf": time.Now().Unix(),    //not before
 		"iss": app.config.auth.token.iss,
 		"aud": app.config.auth.token.iss,
+		"jti": uuid.New().String(), // token id, used for revocation
+		"typ": accessTokenType,
+		"mfa": mfa,
 	}
-	token, err := app.authenticator.GenerateToken(claims)
+
+	return app.authenticator.GenerateToken(claims)
+}
+
+// Logout godoc
+//
+//	@Summary		Logs out the current session
+//	@Description	Revokes the access token used for the request and, if supplied, its refresh token
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	logoutPayload	false	"Refresh token to revoke"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/logout [post]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var payload logoutPayload
+	// the body is optional
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	claims := getClaimsFromContext(r)
+	ctx := r.Context()
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		app.unauthorized(w, r, fmt.Errorf("token is missing an expiry"))
+		return
+	}
+
+	jti, _ := claims["jti"].(string)
+	if err := app.revocations().Revoke(ctx, jti, user.ID, exp.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		if err := app.store.RefreshTokens.RevokeByToken(ctx, auth.HashToken(payload.RefreshToken)); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// LogoutAll godoc
+//
+//	@Summary		Logs out every session
+//	@Description	Revokes every access and refresh token issued to the current user
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		204
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/logout/all [post]
+func (app *application) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if err := app.revokeAllSessions(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// revokeAllSessions should be called whenever a users credentials change
+func (app *application) revokeAllSessions(ctx context.Context, userID int64) error {
+	// iat and the revocation list both keep microseconds
+	now := time.Now().Truncate(time.Microsecond)
+
+	// no access token issued before now outlives the token expiry
+	if err := app.revocations().RevokeUser(ctx, userID, now, now.Add(app.config.auth.token.exp)); err != nil {
+		return err
+	}
+
+	return app.store.RefreshTokens.RevokeAllForUser(ctx, userID)
+}
+
+// purgeRevocations keeps the postgres revocation list from growing, a revoked token is only
+// listed until it would have expired
+func (app *application) purgeRevocations(ctx context.Context) {
+	ticker := time.NewTicker(app.config.auth.token.revocationPurge)
+	defer ticker.Stop()
+
+	for {
+		if _, err := app.store.Revocations.PurgeExpired(ctx); err != nil {
+			app.logger.Errorw("error purging expired revocations", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ForgotPassword godoc
+//
+//	@Summary		Requests a password reset
+//	@Description	Emails a one time password reset link if the account exists
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	forgotPasswordPayload	true	"Account email"
+//	@Success		202
+//	@Failure		400	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/authentication/password/forgot [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload forgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// always accept so the endpoint can't be used to find registered emails
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
 	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	plainToken := uuid.New().String()
+
+	//store token in db (hashed)
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	if err := app.store.Users.CreatePasswordReset(ctx, user.ID, hashToken, app.config.mail.resetExp); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	// send to the client
-	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		ResetURL:  fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, plainToken),
+		ExpiresIn: app.config.mail.resetExp.String(),
+	}
+
+	// sent in the background, the response time would otherwise reveal whether the email exists
+	isProdEnv := app.config.env == "production"
+	go func() {
+		status, err := app.mailer.Send(mail.PasswordResetTemplate, user.Username, user.Email, vars, !isProdEnv)
+		if err != nil || status != http.StatusOK {
+			app.logger.Errorw("error sending password reset email", "user_id", user.ID, "error", err)
+			return
+		}
+
+		app.logger.Infow("Email sent", "status code", status)
+	}()
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
 		app.internalServerError(w, r, err)
+	}
+}
+
+// ResetPassword godoc
+//
+//	@Summary		Resets a password
+//	@Description	Sets a new password using a reset token and logs out every session
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	resetPasswordPayload	true	"Reset token and new password"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/authentication/password/reset [post]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload resetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
 		return
 	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	user := &store.User{}
+	// hash the new password
+	if err := user.Password.Set(payload.Password); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Users.ResetPassword(ctx, payload.Token, user); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.badRequest(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// anyone holding the old password may have active sessions
+	if err := app.revokeAllSessions(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func getClaimsFromContext(r *http.Request) jwt.MapClaims {
+	claims, _ := r.Context().Value(claimsCtx).(jwt.MapClaims)
+	return claims
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/robertgouveia/social/internal/auth"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// revokedUserStore reports every user as logged out of all sessions at revokedAt
+type revokedUserStore struct {
+	store.MockRevocationStore
+	revokedAt time.Time
+}
+
+func (s *revokedUserStore) UserRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	return s.revokedAt, nil
+}
+
+func TestIsTokenRevoked(t *testing.T) {
+	app := newTestApplication(t)
+	revokedAt := time.Now().Truncate(time.Microsecond)
+	app.store.Revocations = &revokedUserStore{revokedAt: revokedAt}
+
+	tests := []struct {
+		name    string
+		iat     float64
+		revoked bool
+	}{
+		{"issued before the revocation", issuedAt(revokedAt.Add(-time.Second)), true},
+		{"issued just before the revocation", issuedAt(revokedAt.Add(-time.Millisecond)), true},
+		{"issued just after the revocation", issuedAt(revokedAt.Add(time.Millisecond)), false},
+		{"issued after the revocation", issuedAt(revokedAt.Add(time.Second)), false},
+		{"issued in whole seconds before the revocation", float64(revokedAt.Unix()), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// parsed claims hold numbers as float64
+			claims := jwt.MapClaims{"jti": "3b241101-e2bb-4255-8caf-4136c566a962", "iat": tt.iat}
+
+			revoked, err := app.isTokenRevoked(context.Background(), 42, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if revoked != tt.revoked {
+				t.Errorf("Expected revoked to be %v, got %v", tt.revoked, revoked)
+			}
+		})
+	}
+}
+
+func TestIssuedAtKeepsMicroseconds(t *testing.T) {
+	authenticator := auth.NewJWTAuthenticator("secret", "test", "test")
+	now := time.Now().Truncate(time.Microsecond)
+
+	token, err := authenticator.GenerateToken(jwt.MapClaims{
+		"sub": int64(42),
+		"aud": "test",
+		"iss": "test",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": issuedAt(now),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := authenticator.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iat, _ := parsed.Claims.(jwt.MapClaims)["iat"].(float64)
+	if got := time.UnixMicro(int64(math.Round(iat * 1e6))); !got.Equal(now) {
+		t.Errorf("Expected iat %v, got %v", now, got)
+	}
+}
+
+// resetUserStore only knows the reset token "valid", which belongs to user 5, and no emails
+type resetUserStore struct {
+	store.MockUserStore
+	resets int
+}
+
+func (s *resetUserStore) GetByEmail(ctx context.Context, email string) (*store.User, error) {
+	return nil, store.ErrNotFound
+}
+
+func (s *resetUserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, resetExp time.Duration) error {
+	s.resets++
+	return nil
+}
+
+func (s *resetUserStore) ResetPassword(ctx context.Context, token string, user *store.User) error {
+	if token != "valid" {
+		return store.ErrNotFound
+	}
+
+	user.ID = 5
+	return nil
+}
+
+type resetRevocationStore struct {
+	store.MockRevocationStore
+	revoked []int64
+}
+
+func (s *resetRevocationStore) RevokeUser(ctx context.Context, userID int64, at time.Time, expiry time.Time) error {
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+type resetRefreshTokenStore struct {
+	store.MockRefreshTokenStore
+	revoked []int64
+}
+
+func (s *resetRefreshTokenStore) RevokeAllForUser(ctx context.Context, userID int64) error {
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+	users := &resetUserStore{}
+	revocations := &resetRevocationStore{}
+	refreshTokens := &resetRefreshTokenStore{}
+	app.store.Users = users
+	app.store.Revocations = revocations
+	app.store.RefreshTokens = refreshTokens
+	mux := app.mount()
+
+	post := func(t *testing.T, path, body string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("Should accept an unknown email without creating a reset", func(t *testing.T) {
+		checkResponseCode(t, http.StatusAccepted, post(t, "/v1/authentication/password/forgot", `{"email": "nobody@test.com"}`))
+
+		if users.resets != 0 {
+			t.Errorf("Expected no reset to be created, got %d", users.resets)
+		}
+	})
+
+	t.Run("Should require a valid email", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, post(t, "/v1/authentication/password/forgot", `{"email": "nobody"}`))
+	})
+
+	t.Run("Should reject an unknown or expired token", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, post(t, "/v1/authentication/password/reset", `{"token": "expired", "password": "newpassword"}`))
+
+		if len(revocations.revoked) != 0 || len(refreshTokens.revoked) != 0 {
+			t.Errorf("Expected no sessions to be revoked, got %v and %v", revocations.revoked, refreshTokens.revoked)
+		}
+	})
+
+	t.Run("Should reject a password that is too short", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, post(t, "/v1/authentication/password/reset", `{"token": "valid", "password": "no"}`))
+	})
+
+	t.Run("Should reset the password and log out every session", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, post(t, "/v1/authentication/password/reset", `{"token": "valid", "password": "newpassword"}`))
+
+		if len(revocations.revoked) != 1 || revocations.revoked[0] != 5 {
+			t.Errorf("Expected user 5s access tokens to be revoked, got %v", revocations.revoked)
+		}
+
+		if len(refreshTokens.revoked) != 1 || refreshTokens.revoked[0] != 5 {
+			t.Errorf("Expected user 5s refresh tokens to be revoked, got %v", refreshTokens.revoked)
+		}
+	})
+}
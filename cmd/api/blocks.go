@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// BlockUser godoc
+//
+//	@Summary		Blocks a user
+//	@Description	Removes follows both ways, hides each others posts and comments and stops new follows and comments
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateUserRelation(w, r, app.store.Blocks.Block, true)
+}
+
+// UnblockUser godoc
+//
+//	@Summary		Unblocks a user
+//	@Description	Unblocking doesn't restore the follows the block removed
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/block [delete]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateUserRelation(w, r, app.store.Blocks.Unblock, false)
+}
+
+// MuteUser godoc
+//
+//	@Summary		Mutes a user
+//	@Description	Hides the users posts from your feed, they aren't told and can still interact with you
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateUserRelation(w, r, app.store.Mutes.Mute, false)
+}
+
+// UnmuteUser godoc
+//
+//	@Summary		Unmutes a user
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/mute [delete]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateUserRelation(w, r, app.store.Mutes.Unmute, false)
+}
+
+// GetBlocks godoc
+//
+//	@Summary		Lists blocked users
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{array}		store.BlockedUser
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/blocks [get]
+func (app *application) getBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	app.blockedUsersList(w, r, app.store.Blocks.GetByUserID)
+}
+
+// GetMutes godoc
+//
+//	@Summary		Lists muted users
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{array}		store.BlockedUser
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/mutes [get]
+func (app *application) getMutesHandler(w http.ResponseWriter, r *http.Request) {
+	app.blockedUsersList(w, r, app.store.Mutes.GetByUserID)
+}
+
+// updateUserRelation blocks, mutes or undoes either between the caller and the user in the url.
+// Both timelines are dropped when the change affects both users
+func (app *application) updateUserRelation(w http.ResponseWriter, r *http.Request, update func(context.Context, int64, int64) error, mutual bool) {
+	user := getUserFromContext(r)
+	targetID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if targetID == user.ID {
+		app.badRequest(w, r, fmt.Errorf("you can not do this to yourself"))
+		return
+	}
+
+	ctx := r.Context()
+
+	target, err := app.getUser(ctx, targetID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := update(ctx, user.ID, target.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if mutual {
+		app.dropTimelines(ctx, user.ID, target.ID)
+	} else {
+		app.dropTimelines(ctx, user.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) blockedUsersList(w http.ResponseWriter, r *http.Request, list func(context.Context, int64, store.PaginatedQuery) ([]store.BlockedUser, error)) {
+	pq, err := defaultFollowsQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	users, err := list(r.Context(), getUserFromContext(r).ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// postCommentStore keeps comments on post 2, comment 1 is the test users own and the rest are user 7s
+type postCommentStore struct {
+	store.MockCommentStore
+	created []store.Comment
+	updated []int64
+	deleted []int64
+}
+
+func (s *postCommentStore) Create(ctx context.Context, comment *store.Comment) error {
+	if comment.ParentID != nil && *comment.ParentID == 99 {
+		return store.ErrNotFound
+	}
+
+	s.created = append(s.created, *comment)
+	return nil
+}
+
+func (s *postCommentStore) GetByID(ctx context.Context, commentID int64) (*store.Comment, error) {
+	userID := int64(7)
+	if commentID == 1 {
+		userID = 42
+	}
+
+	return &store.Comment{ID: commentID, PostID: 2, UserID: userID}, nil
+}
+
+func (s *postCommentStore) Update(ctx context.Context, comment *store.Comment) error {
+	s.updated = append(s.updated, comment.ID)
+	return nil
+}
+
+func (s *postCommentStore) Delete(ctx context.Context, commentID int64) error {
+	s.deleted = append(s.deleted, commentID)
+	return nil
+}
+
+func TestComments(t *testing.T) {
+	app := newTestApplication(t)
+	app.store.Posts = &publicPostStore{}
+	comments := &postCommentStore{}
+	app.store.Comments = comments
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(t *testing.T, method, path, body string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("Should comment as the current user", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, request(t, http.MethodPost, "/v1/posts/2/comments", `{"content": "nice"}`))
+
+		if len(comments.created) != 1 {
+			t.Fatalf("Expected one comment to be created and got %d", len(comments.created))
+		}
+
+		if c := comments.created[0]; c.UserID != 42 || c.PostID != 2 || c.Content != "nice" {
+			t.Errorf("Expected user 42s comment on post 2 and got %+v", c)
+		}
+	})
+
+	t.Run("Should reject an empty comment", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, request(t, http.MethodPost, "/v1/posts/2/comments", `{"content": ""}`))
+	})
+
+	t.Run("Should reject a reply to a missing comment", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, request(t, http.MethodPost, "/v1/posts/2/comments", `{"content": "nice", "parent_id": 99}`))
+	})
+
+	t.Run("Should reject a page larger than the limit", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, request(t, http.MethodGet, "/v1/posts/2/comments?limit=100", ""))
+	})
+
+	t.Run("Should let the author edit and delete their comment", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodPatch, "/v1/posts/2/comments/1", `{"content": "edited"}`))
+		checkResponseCode(t, http.StatusNoContent, request(t, http.MethodDelete, "/v1/posts/2/comments/1", ""))
+
+		if len(comments.updated) != 1 || len(comments.deleted) != 1 {
+			t.Errorf("Expected comment 1 to be updated and deleted, got %v and %v", comments.updated, comments.deleted)
+		}
+	})
+
+	t.Run("Should not let other users edit or delete a comment", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodPatch, "/v1/posts/2/comments/2", `{"content": "edited"}`))
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodDelete, "/v1/posts/2/comments/2", ""))
+	})
+
+	t.Run("Should 404 a comment under another post", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, request(t, http.MethodPatch, "/v1/posts/3/comments/1", `{"content": "edited"}`))
+	})
+
+	if len(comments.updated) != 1 || len(comments.deleted) != 1 {
+		t.Errorf("Expected only the authors changes to reach the store, got %v and %v", comments.updated, comments.deleted)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/robertgouveia/social/internal/store"
+)
+
+var defaultDraftsQuery = store.PaginatedQuery{
+	Limit:  20,
+	Offset: 0,
+	Sort:   "desc",
+}
+
+type PublishPostPayload struct {
+	// schedules the post and must be in the future, it's published now when empty
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// GetDrafts godoc
+//
+//	@Summary		Lists the users drafts
+//	@Description	Lists the users drafts and scheduled posts, newest first by default
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{array}		store.Post
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/drafts [get]
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := defaultDraftsQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	drafts, err := app.store.Posts.GetDrafts(r.Context(), getUserFromContext(r).ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, drafts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// PublishPost godoc
+//
+//	@Summary		Publishes a draft
+//	@Description	Publishes a draft or scheduled post now, or schedules it for publish_at
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Post ID"
+//	@Param			payload	body		PublishPostPayload	true	"Publish at"
+//	@Success		200		{object}	store.Post
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/publish [put]
+func (app *application) publishPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	if post.UserID != getUserFromContext(r).ID {
+		app.forbidden(w, r, errors.New("only the author can publish a post"))
+		return
+	}
+
+	var payload PublishPostPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if payload.PublishAt != nil && !payload.PublishAt.After(time.Now()) {
+		app.badRequest(w, r, errors.New("publish_at must be in the future"))
+		return
+	}
+
+	post.Status = store.PostStatusPublished
+	post.PublishAt = nil
+	if payload.PublishAt != nil {
+		post.Status = store.PostStatusScheduled
+		post.PublishAt = payload.PublishAt
+	}
+
+	if err := app.store.Posts.Publish(r.Context(), post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflict(w, r, errors.New("post is already published"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if post.Status == store.PostStatusPublished {
+		go app.fanOutPost(post)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// publishScheduledPosts publishes scheduled posts as they fall due. Each instance of the
+// api runs it, a batch is claimed with SKIP LOCKED so a post is only published once
+func (app *application) publishScheduledPosts(ctx context.Context) {
+	ticker := time.NewTicker(app.config.publisher.interval)
+	defer ticker.Stop()
+
+	for {
+		// keep going while full batches come back, there may be more due
+		for {
+			published, err := app.store.Posts.PublishDue(ctx, app.config.publisher.batchSize)
+			if err != nil {
+				app.logger.Errorw("error publishing scheduled posts", "error", err)
+				break
+			}
+
+			for i := range published {
+				app.fanOutPost(&published[i])
+			}
+
+			if len(published) < app.config.publisher.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
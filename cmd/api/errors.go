@@ -1,7 +1,10 @@
 package main
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -43,3 +46,22 @@ func (app *application) forbidden(w http.ResponseWriter, r *http.Request, err er
 
 	writeJSONError(w, http.StatusForbidden, "Forbidden")
 }
+
+func (app *application) tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	app.logger.Warnw("Too Many Requests", "method", r.Method, "path", r.URL.Path, "retry_after", retryAfter.String())
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeJSONError(w, http.StatusTooManyRequests, "Too many attempts, try again in "+retryAfter.Round(time.Second).String())
+}
+
+func (app *application) payloadTooLarge(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("Payload Too Large", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+func (app *application) unsupportedMediaType(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("Unsupported Media Type", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/robertgouveia/social/internal/store"
+)
+
+var defaultExploreQuery = store.PaginatedQuery{
+	Limit:  20,
+	Offset: 0,
+	Sort:   "desc",
+}
+
+// GetExplore godoc
+//
+//	@Summary		Gets the explore feed
+//	@Description	Recent popular posts from everyone, ranked by comments and reactions decayed by age
+//	@Tags			feed
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{array}		store.PostWithMetaData
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/explore [get]
+func (app *application) getExploreHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := defaultExploreQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	ranked, err := app.explorePosts(ctx)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// the ranking is shared and can be minutes old, so the posts are reloaded for the viewer to
+	// drop ones deleted or hidden since and apply their blocks
+	ids := make([]int64, len(ranked))
+	for i, p := range ranked {
+		ids[i] = p.ID
+	}
+
+	posts, err := app.store.Posts.GetExploreByIDs(ctx, getUserFromContext(r).ID, ids)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// the ranked list is computed as a whole, pages are cut from it
+	start := min(pq.Offset, len(posts))
+	end := min(start+pq.Limit, len(posts))
+	page := posts[start:end]
+
+	if err := app.loadAttachments(ctx, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetTrendingTags godoc
+//
+//	@Summary		Gets the trending tags
+//	@Description	The most used tags on recent posts
+//	@Tags			feed
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		store.TagCount
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/trending [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := app.trendingTags(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) explorePosts(ctx context.Context) ([]store.PostWithMetaData, error) {
+	if !app.config.redisCfg.enabled {
+		return app.store.Posts.GetExplore(ctx, app.config.explore.window, app.config.explore.size)
+	}
+
+	posts, err := app.cacheStorage.Explore.GetPosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if posts == nil {
+		posts, err = app.store.Posts.GetExplore(ctx, app.config.explore.window, app.config.explore.size)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := app.cacheStorage.Explore.SetPosts(ctx, posts); err != nil {
+			return nil, err
+		}
+	}
+
+	return posts, nil
+}
+
+func (app *application) trendingTags(ctx context.Context) ([]store.TagCount, error) {
+	if !app.config.redisCfg.enabled {
+		return app.store.Posts.GetTrendingTags(ctx, app.config.explore.trendingWindow, app.config.explore.trendingSize)
+	}
+
+	tags, err := app.cacheStorage.Explore.GetTrendingTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tags == nil {
+		tags, err = app.store.Posts.GetTrendingTags(ctx, app.config.explore.trendingWindow, app.config.explore.trendingSize)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := app.cacheStorage.Explore.SetTrendingTags(ctx, tags); err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// refreshExplore recomputes the cached explore feed and trending tags on an interval until ctx is done
+func (app *application) refreshExplore(ctx context.Context) {
+	ticker := time.NewTicker(app.config.explore.refresh)
+	defer ticker.Stop()
+
+	for {
+		if err := app.recomputeExplore(ctx); err != nil {
+			app.logger.Errorw("error refreshing explore", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) recomputeExplore(ctx context.Context) error {
+	posts, err := app.store.Posts.GetExplore(ctx, app.config.explore.window, app.config.explore.size)
+	if err != nil {
+		return err
+	}
+
+	if err := app.cacheStorage.Explore.SetPosts(ctx, posts); err != nil {
+		return err
+	}
+
+	tags, err := app.store.Posts.GetTrendingTags(ctx, app.config.explore.trendingWindow, app.config.explore.trendingSize)
+	if err != nil {
+		return err
+	}
+
+	return app.cacheStorage.Explore.SetTrendingTags(ctx, tags)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/robertgouveia/social/internal/store"
+	"github.com/robertgouveia/social/internal/store/cache"
+)
+
+// rankedPostStore ranks posts 5 to 1 for explore, post 4 has since been hidden from the viewer
+type rankedPostStore struct {
+	store.MockPostStore
+	ranked  int
+	trended int
+}
+
+func (s *rankedPostStore) GetExplore(ctx context.Context, window time.Duration, limit int) ([]store.PostWithMetaData, error) {
+	s.ranked++
+
+	posts := []store.PostWithMetaData{}
+	for id := int64(5); id > 0; id-- {
+		posts = append(posts, store.PostWithMetaData{Post: store.Post{ID: id}})
+	}
+	return posts, nil
+}
+
+func (s *rankedPostStore) GetExploreByIDs(ctx context.Context, viewerID int64, postIDs []int64) ([]store.PostWithMetaData, error) {
+	posts := []store.PostWithMetaData{}
+	for _, id := range postIDs {
+		if id != 4 {
+			posts = append(posts, store.PostWithMetaData{Post: store.Post{ID: id}})
+		}
+	}
+	return posts, nil
+}
+
+func (s *rankedPostStore) GetTrendingTags(ctx context.Context, window time.Duration, limit int) ([]store.TagCount, error) {
+	s.trended++
+	return []store.TagCount{{Tag: "go", Count: 3}}, nil
+}
+
+// memoryExploreStore keeps the explore lists like redis would, nil until they are set
+type memoryExploreStore struct {
+	cache.MockExploreStore
+	posts []store.PostWithMetaData
+	tags  []store.TagCount
+}
+
+func (s *memoryExploreStore) GetPosts(ctx context.Context) ([]store.PostWithMetaData, error) {
+	return s.posts, nil
+}
+
+func (s *memoryExploreStore) SetPosts(ctx context.Context, posts []store.PostWithMetaData) error {
+	s.posts = posts
+	return nil
+}
+
+func (s *memoryExploreStore) GetTrendingTags(ctx context.Context) ([]store.TagCount, error) {
+	return s.tags, nil
+}
+
+func (s *memoryExploreStore) SetTrendingTags(ctx context.Context, tags []store.TagCount) error {
+	s.tags = tags
+	return nil
+}
+
+func TestExplore(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.redisCfg.enabled = true
+	posts := &rankedPostStore{}
+	app.store.Posts = posts
+	app.cacheStorage.Explore = &memoryExploreStore{}
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(t *testing.T, path string, v any) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		if rr.Code == http.StatusOK {
+			if err := json.NewDecoder(rr.Body).Decode(&struct {
+				Data any `json:"data"`
+			}{Data: v}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return rr.Code
+	}
+
+	t.Run("Should page through the ranking without the hidden posts", func(t *testing.T) {
+		for _, page := range []struct {
+			path string
+			want []int64
+		}{
+			{"/v1/explore?limit=2", []int64{5, 3}},
+			{"/v1/explore?limit=2&offset=2", []int64{2, 1}},
+			{"/v1/explore?limit=2&offset=4", []int64{}},
+		} {
+			var feed []store.PostWithMetaData
+			checkResponseCode(t, http.StatusOK, get(t, page.path, &feed))
+
+			ids := []int64{}
+			for _, p := range feed {
+				ids = append(ids, p.ID)
+			}
+
+			if !slices.Equal(ids, page.want) {
+				t.Errorf("Expected %s to return %v and got %v", page.path, page.want, ids)
+			}
+		}
+
+		// the pages after the first are cut from the cached ranking
+		if posts.ranked != 1 {
+			t.Errorf("Expected the ranking to be computed once and it was computed %d times", posts.ranked)
+		}
+	})
+
+	t.Run("Should reject a page larger than the limit", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, get(t, "/v1/explore?limit=100", nil))
+	})
+
+	t.Run("Should cache the trending tags", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			var tags []store.TagCount
+			checkResponseCode(t, http.StatusOK, get(t, "/v1/tags/trending", &tags))
+
+			if len(tags) != 1 || tags[0].Tag != "go" {
+				t.Errorf("Expected the go tag and got %v", tags)
+			}
+		}
+
+		if posts.trended != 1 {
+			t.Errorf("Expected the tags to be counted once and they were counted %d times", posts.trended)
+		}
+	})
+
+	t.Run("Should recompute both lists on refresh", func(t *testing.T) {
+		if err := app.recomputeExplore(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if posts.ranked != 2 || posts.trended != 2 {
+			t.Errorf("Expected both lists to be recomputed, ranked %d and counted %d times", posts.ranked, posts.trended)
+		}
+	})
+}
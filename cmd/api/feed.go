@@ -1,12 +1,50 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/robertgouveia/social/internal/store"
 )
 
+// GetUserFeed godoc
+//
+//	@Summary		Gets the users feed
+//	@Description	Gets the posts from followed users. Pages with the cursor from next_cursor / prev_cursor, offset is only kept for older clients
+//	@Tags			feed
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Search"
+//	@Param			since	query		string	false	"Since, UTC (YYYY-MM-DD HH:MM:SS)"
+//	@Param			until	query		string	false	"Until, UTC (YYYY-MM-DD HH:MM:SS)"
+//	@Success		200		{array}		store.PostWithMetaData
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	app.postsPage(w, r, func(ctx context.Context, fq store.PaginatedFeedQuery) ([]store.PostWithMetaData, error) {
+		if feed, ok := app.getTimelineFeed(ctx, user.ID, fq); ok {
+			return feed, nil
+		}
+
+		return app.store.Posts.GetUserFeed(ctx, user.ID, fq)
+	})
+}
+
+// postsPage parses the feed query, loads a page with it and responds with the
+// page and its cursors. load is asked for one more post than the limit
+func (app *application) postsPage(w http.ResponseWriter, r *http.Request, load func(context.Context, store.PaginatedFeedQuery) ([]store.PostWithMetaData, error)) {
 	//pagination, filters, sort
 	fq := store.PaginatedFeedQuery{
 		Limit:  20,
@@ -20,19 +58,110 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		cursor, err := store.DecodeFeedCursor(token, []byte(app.config.pagination.cursorSecret))
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		// a cursor only pages through the list it came from
+		if cursor.Query != fq.Fingerprint() {
+			app.badRequest(w, r, store.ErrInvalidCursor)
+			return
+		}
+		fq.Cursor = cursor
+		fq.Offset = 0
+	}
+
 	if err := Validate.Struct(fq); err != nil {
 		app.badRequest(w, r, err)
 		return
 	}
 
-	ctx := r.Context()
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(23), fq)
+	// one extra post tells us if there is another page
+	limit := fq.Limit
+	fq.Limit++
+
+	feed, err := load(r.Context(), fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	backwards := fq.Cursor != nil && fq.Cursor.Before
+	more := len(feed) > limit
+	if more {
+		// the extra post is at the far end of the direction we paged in
+		if backwards {
+			feed = feed[1:]
+		} else {
+			feed = feed[:limit]
+		}
+	}
+
+	var next, prev *string
+	if len(feed) > 0 {
+		if more || backwards {
+			next, err = app.feedCursor(fq, feed[len(feed)-1], false)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+
+		if (backwards && more) || (!backwards && (fq.Cursor != nil || fq.Offset > 0)) {
+			prev, err = app.feedCursor(fq, feed[0], true)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+	}
+
+	if err := app.loadAttachments(r.Context(), feed); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if link := feedLinkHeader(r, next, prev); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	if err := app.jsonPageResponse(w, http.StatusOK, feed, next, prev); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
+
+func (app *application) feedCursor(fq store.PaginatedFeedQuery, post store.PostWithMetaData, before bool) (*string, error) {
+	createdAt, err := time.Parse(time.RFC3339, post.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("parsing post created_at: %w", err)
+	}
+
+	cursor := store.FeedCursor{CreatedAt: createdAt, ID: post.ID, Before: before, Query: fq.Fingerprint()}.Encode([]byte(app.config.pagination.cursorSecret))
+	return &cursor, nil
+}
+
+// feedLinkHeader is RFC 8288, the links repeat the request with the cursor swapped in
+func feedLinkHeader(r *http.Request, next, prev *string) string {
+	var links []string
+	for _, l := range []struct {
+		rel    string
+		cursor *string
+	}{{"next", next}, {"prev", prev}} {
+		if l.cursor == nil {
+			continue
+		}
+
+		qs := r.URL.Query()
+		qs.Del("offset")
+		qs.Set("cursor", *l.cursor)
+
+		u := *r.URL
+		u.RawQuery = qs.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), l.rel))
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+type UpdatePrivacyPayload struct {
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+// SetPrivacy godoc
+//
+//	@Summary		Makes the account private or public
+//	@Description	Private accounts approve their followers, making the account public approves every pending request
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdatePrivacyPayload	true	"Privacy"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/privacy [put]
+func (app *application) setPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdatePrivacyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if err := app.store.Users.SetPrivate(ctx, user.ID, *payload.IsPrivate); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user.IsPrivate = *payload.IsPrivate
+	if app.config.redisCfg.enabled {
+		if err := app.cacheStorage.Users.Set(ctx, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetFollowRequests godoc
+//
+//	@Summary		Lists pending follow requests
+//	@Description	Lists the follow requests waiting on the authenticated user, newest first by default
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{array}		store.FollowRequest
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/follow-requests [get]
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := defaultFollowsQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	requests, err := app.store.FollowRequests.GetByUserID(r.Context(), getUserFromContext(r).ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, requests); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ApproveFollowRequest godoc
+//
+//	@Summary		Approves a follow request
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			requesterID	path	int	true	"Requester ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/follow-requests/{requesterID} [put]
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.store.FollowRequests.Approve, true)
+}
+
+// RejectFollowRequest godoc
+//
+//	@Summary		Rejects a follow request
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			requesterID	path	int	true	"Requester ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/follow-requests/{requesterID} [delete]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.store.FollowRequests.Delete, false)
+}
+
+func (app *application) answerFollowRequest(w http.ResponseWriter, r *http.Request, answer func(context.Context, int64, int64) error, approved bool) {
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "requesterID"), 10, 64)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	if err := answer(ctx, requesterID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if approved {
+		app.followed(ctx, requesterID, user.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// requestFollow asks a private account to approve the follower
+func (app *application) requestFollow(w http.ResponseWriter, r *http.Request, follower, user *store.User) {
+	ctx := r.Context()
+
+	following, err := app.store.Followers.IsFollowing(ctx, follower.ID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if following {
+		app.conflict(w, r, store.ErrConflict)
+		return
+	}
+
+	if err := app.store.FollowRequests.Create(ctx, follower.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflict(w, r, err)
+		case errors.Is(err, store.ErrBlocked):
+			app.forbidden(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// canViewPosts is whether viewer can read the posts of author. Nobody sees the posts
+// of someone they've blocked or been blocked by, private accounts are readable by
+// themselves, their approved followers and moderators
+func (app *application) canViewPosts(ctx context.Context, viewer, author *store.User) (bool, error) {
+	if viewer.ID == author.ID {
+		return true, nil
+	}
+
+	blocked, err := app.store.Blocks.IsBlocked(ctx, viewer.ID, author.ID)
+	if err != nil || blocked {
+		return false, err
+	}
+
+	if !author.IsPrivate {
+		return true, nil
+	}
+
+	following, err := app.store.Followers.IsFollowing(ctx, viewer.ID, author.ID)
+	if err != nil || following {
+		return following, err
+	}
+
+	return app.checkRolePrecedence(ctx, viewer, "moderator")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// the test token belongs to user 42, users 7 and 8 are private and 42 only follows 8
+const (
+	privateUserID  = 7
+	followedUserID = 8
+	publicUserID   = 9
+)
+
+type privacyUserStore struct {
+	store.MockUserStore
+	setPrivate []bool
+}
+
+func (s *privacyUserStore) GetByID(ctx context.Context, userID int64) (*store.User, error) {
+	return &store.User{ID: userID, IsPrivate: userID == privateUserID || userID == followedUserID}, nil
+}
+
+func (s *privacyUserStore) SetPrivate(ctx context.Context, userID int64, private bool) error {
+	s.setPrivate = append(s.setPrivate, private)
+	return nil
+}
+
+type privacyFollowerStore struct {
+	store.MockFollowerStore
+	follows [][2]int64
+}
+
+func (s *privacyFollowerStore) IsFollowing(ctx context.Context, followerID, userID int64) (bool, error) {
+	return followerID == 42 && userID == followedUserID, nil
+}
+
+func (s *privacyFollowerStore) Follow(ctx context.Context, followerID, userID int64) error {
+	s.follows = append(s.follows, [2]int64{followerID, userID})
+	return nil
+}
+
+// privacyFollowRequestStore only has a pending request from user 5 to user 42
+type privacyFollowRequestStore struct {
+	store.MockFollowRequestStore
+	created  [][2]int64
+	approved [][2]int64
+	deleted  [][2]int64
+}
+
+func (s *privacyFollowRequestStore) Create(ctx context.Context, requesterID, userID int64) error {
+	s.created = append(s.created, [2]int64{requesterID, userID})
+	return nil
+}
+
+func (s *privacyFollowRequestStore) Approve(ctx context.Context, requesterID, userID int64) error {
+	if requesterID != 5 || userID != 42 {
+		return store.ErrNotFound
+	}
+	s.approved = append(s.approved, [2]int64{requesterID, userID})
+	return nil
+}
+
+func (s *privacyFollowRequestStore) Delete(ctx context.Context, requesterID, userID int64) error {
+	if requesterID != 5 || userID != 42 {
+		return store.ErrNotFound
+	}
+	s.deleted = append(s.deleted, [2]int64{requesterID, userID})
+	return nil
+}
+
+func TestPrivateAccounts(t *testing.T) {
+	app := newTestApplication(t)
+	users := &privacyUserStore{}
+	followers := &privacyFollowerStore{}
+	requests := &privacyFollowRequestStore{}
+	app.store.Users = users
+	app.store.Followers = followers
+	app.store.FollowRequests = requests
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(t *testing.T, method, path, body string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("Should request to follow a private account", func(t *testing.T) {
+		checkResponseCode(t, http.StatusAccepted, request(t, http.MethodPut, "/v1/users/7/follow", ""))
+
+		if len(requests.created) != 1 || requests.created[0] != [2]int64{42, privateUserID} {
+			t.Errorf("Expected a follow request from 42 to %d, got %v", privateUserID, requests.created)
+		}
+
+		if len(followers.follows) != 0 {
+			t.Errorf("Expected no follow until the request is approved, got %v", followers.follows)
+		}
+	})
+
+	t.Run("Should not request to follow an account already followed", func(t *testing.T) {
+		checkResponseCode(t, http.StatusConflict, request(t, http.MethodPut, "/v1/users/8/follow", ""))
+	})
+
+	t.Run("Should follow a public account straight away", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, request(t, http.MethodPut, "/v1/users/9/follow", ""))
+
+		if len(followers.follows) != 1 || followers.follows[0] != [2]int64{42, publicUserID} {
+			t.Errorf("Expected 42 to follow %d, got %v", publicUserID, followers.follows)
+		}
+	})
+
+	t.Run("Should approve a pending request", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, request(t, http.MethodPut, "/v1/users/follow-requests/5", ""))
+
+		if len(requests.approved) != 1 || requests.approved[0] != [2]int64{5, 42} {
+			t.Errorf("Expected the request from 5 to be approved, got %v", requests.approved)
+		}
+	})
+
+	t.Run("Should reject a pending request", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, request(t, http.MethodDelete, "/v1/users/follow-requests/5", ""))
+
+		if len(requests.deleted) != 1 || requests.deleted[0] != [2]int64{5, 42} {
+			t.Errorf("Expected the request from 5 to be rejected, got %v", requests.deleted)
+		}
+	})
+
+	t.Run("Should 404 answering a request that doesn't exist", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, request(t, http.MethodPut, "/v1/users/follow-requests/6", ""))
+		checkResponseCode(t, http.StatusNotFound, request(t, http.MethodDelete, "/v1/users/follow-requests/6", ""))
+	})
+
+	t.Run("Should make the account public", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodPut, "/v1/users/privacy", `{"is_private": false}`))
+
+		// the store approves every pending request in the same transaction
+		if len(users.setPrivate) != 1 || users.setPrivate[0] {
+			t.Errorf("Expected the account to be made public, got %v", users.setPrivate)
+		}
+	})
+
+	t.Run("Should require the privacy setting", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, request(t, http.MethodPut, "/v1/users/privacy", `{}`))
+	})
+
+	t.Run("Should hide a private accounts posts from non followers", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, request(t, http.MethodGet, "/v1/users/7/posts", ""))
+	})
+
+	t.Run("Should show a private accounts posts to followers", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodGet, "/v1/users/8/posts", ""))
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodGet, "/v1/users/9/posts", ""))
+	})
+}
@@ -47,3 +47,14 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+// jsonPageResponse is jsonResponse for cursor paginated lists, a nil cursor means there is no page that way
+func (app *application) jsonPageResponse(w http.ResponseWriter, status int, data any, next, prev *string) error {
+	type envelope struct {
+		Data       any     `json:"data"`
+		NextCursor *string `json:"next_cursor"`
+		PrevCursor *string `json:"prev_cursor"`
+	}
+
+	return writeJSON(w, status, &envelope{Data: data, NextCursor: next, PrevCursor: prev})
+}
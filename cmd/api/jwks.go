@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+)
+
+// JWKS godoc
+//
+//	@Summary		Lists the token verification keys
+//	@Description	Public keys other services can use to verify access tokens, as a JSON Web Key Set
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		200	{object}	auth.JWKSet
+//	@Router			/.well-known/jwks.json [get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	// verifiers refetch on unknown kids, a short cache is enough during rotation
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	// served without the data envelope, JWKS clients expect the set at the top level
+	if err := writeJSON(w, http.StatusOK, app.authenticator.JWKS()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
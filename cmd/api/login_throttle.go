@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robertgouveia/social/internal/mail"
+	"github.com/robertgouveia/social/internal/store"
+	"github.com/robertgouveia/social/internal/store/cache"
+)
+
+// loginRetryAfter is how long the caller must wait before the next attempt:
+// the first few failures are free, then each one doubles the delay until the
+// limit is reached and the key is locked out
+func (app *application) loginRetryAfter(attempt cache.LoginAttempt, maxFailures int) time.Duration {
+	cfg := app.config.auth.login
+
+	var wait time.Duration
+	switch {
+	case attempt.Failures >= maxFailures:
+		wait = cfg.lockout
+	case attempt.Failures >= cfg.freeAttempts:
+		exp := float64(attempt.Failures - cfg.freeAttempts)
+		wait = time.Duration(math.Min(float64(cfg.baseDelay)*math.Pow(2, exp), float64(cfg.maxDelay)))
+	default:
+		return 0
+	}
+
+	return time.Until(attempt.LastFailure.Add(wait))
+}
+
+// loginReservation is an attempt counted against the account and ip keys, account and ip
+// hold what the keys were before it so it can be given back
+type loginReservation struct {
+	accountKey string
+	ipKey      string
+	account    cache.LoginAttempt
+	ip         cache.LoginAttempt
+}
+
+// failures is the account keys count including this attempt
+func (r loginReservation) failures() int {
+	return r.account.Failures + 1
+}
+
+// reserveLoginAttempt counts the attempt against the account and ip keys before the
+// credentials are checked, parallel requests can't all pass on the same count. It returns
+// the longest wait across both keys, a throttled attempt is given back so it doesn't add
+// to the delay
+func (app *application) reserveLoginAttempt(ctx context.Context, accountKey, ipKey string) (time.Duration, loginReservation, error) {
+	cfg := app.config.auth.login
+	res := loginReservation{accountKey: accountKey, ipKey: ipKey}
+
+	account, err := app.cacheStorage.LoginAttempts.Attempt(ctx, accountKey, cfg.lockout)
+	if err != nil {
+		return 0, res, err
+	}
+	res.account = account
+
+	ip, err := app.cacheStorage.LoginAttempts.Attempt(ctx, ipKey, cfg.lockout)
+	if err != nil {
+		return 0, res, err
+	}
+	res.ip = ip
+
+	wait := max(
+		app.loginRetryAfter(account, cfg.maxAccountFailures),
+		app.loginRetryAfter(ip, cfg.maxIPFailures),
+	)
+
+	if wait > 0 {
+		return wait, res, app.releaseLoginAttempt(ctx, res)
+	}
+
+	return 0, res, nil
+}
+
+func (app *application) releaseLoginAttempt(ctx context.Context, res loginReservation) error {
+	if err := app.cacheStorage.LoginAttempts.Release(ctx, res.accountKey, res.account); err != nil {
+		return err
+	}
+
+	return app.cacheStorage.LoginAttempts.Release(ctx, res.ipKey, res.ip)
+}
+
+// loginSucceeded clears the accounts failures, the ip only gets this attempt back
+func (app *application) loginSucceeded(ctx context.Context, res loginReservation) error {
+	if err := app.cacheStorage.LoginAttempts.Reset(ctx, res.accountKey); err != nil {
+		return err
+	}
+
+	return app.cacheStorage.LoginAttempts.Release(ctx, res.ipKey, res.ip)
+}
+
+// loginFailed notifies the user once, when the account first becomes locked. The failure
+// itself was counted when the attempt was reserved, user is nil when the email is unknown
+func (app *application) loginFailed(user *store.User, res loginReservation, ipAddress string) {
+	if user != nil && res.failures() == app.config.auth.login.maxAccountFailures {
+		app.sendSuspiciousLoginEmail(user, ipAddress, res.failures())
+	}
+}
+
+func (app *application) sendSuspiciousLoginEmail(user *store.User, ipAddress string, attempts int) {
+	vars := struct {
+		Username  string
+		IPAddress string
+		Attempts  int
+		LockedFor string
+		ResetURL  string
+	}{
+		Username:  user.Username,
+		IPAddress: ipAddress,
+		Attempts:  attempts,
+		LockedFor: app.config.auth.login.lockout.String(),
+		ResetURL:  fmt.Sprintf("%s/forgot-password", app.config.frontendURL),
+	}
+
+	isProdEnv := app.config.env == "production"
+	go func() {
+		status, err := app.mailer.Send(mail.SuspiciousLoginTemplate, user.Username, user.Email, vars, !isProdEnv)
+		if err != nil || status != http.StatusOK {
+			app.logger.Errorw("error sending suspicious login email", "user_id", user.ID, "error", err)
+			return
+		}
+
+		app.logger.Infow("Email sent", "status code", status)
+	}()
+}
+
+func loginThrottleKeys(email string, r *http.Request) (accountKey, ipKey, ipAddress string) {
+	// RealIP has already replaced RemoteAddr, it only keeps the port when there was no proxy header
+	ipAddress = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ipAddress = host
+	}
+
+	return "account:" + strings.ToLower(email), "ip:" + ipAddress, ipAddress
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReserveLoginAttempt(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.auth.login = loginConfig{
+		freeAttempts:       3,
+		baseDelay:          time.Second,
+		maxDelay:           time.Second * 30,
+		maxAccountFailures: 10,
+		maxIPFailures:      50,
+		lockout:            time.Minute * 15,
+	}
+	ctx := context.Background()
+
+	t.Run("Should only let the free attempts through in parallel", func(t *testing.T) {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		allowed := 0
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				wait, _, err := app.reserveLoginAttempt(ctx, "account:parallel@test.com", "ip:10.0.0.1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if wait == 0 {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if allowed != 3 {
+			t.Errorf("Expected 3 attempts to be allowed and got %d", allowed)
+		}
+	})
+
+	t.Run("Should not count throttled attempts", func(t *testing.T) {
+		_, res, err := app.reserveLoginAttempt(ctx, "account:parallel@test.com", "ip:10.0.0.2")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.account.Failures != 3 {
+			t.Errorf("Expected 3 failures and got %d", res.account.Failures)
+		}
+	})
+
+	t.Run("Should not extend the wait with throttled attempts", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if _, _, err := app.reserveLoginAttempt(ctx, "account:retry@test.com", "ip:10.0.0.4"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// each throttled attempt comes later than the last failure
+		time.Sleep(time.Millisecond * 50)
+
+		first, _, err := app.reserveLoginAttempt(ctx, "account:retry@test.com", "ip:10.0.0.4")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if first <= 0 {
+			t.Fatal("Expected the attempt after the free ones to be throttled")
+		}
+
+		time.Sleep(time.Millisecond * 50)
+
+		second, _, err := app.reserveLoginAttempt(ctx, "account:retry@test.com", "ip:10.0.0.4")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if second > first-time.Millisecond*25 {
+			t.Errorf("Expected the wait to count down from %s and got %s", first, second)
+		}
+	})
+
+	t.Run("Should give the ip its attempt back on success", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			wait, res, err := app.reserveLoginAttempt(ctx, "account:ok@test.com", "ip:10.0.0.3")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if wait > 0 {
+				t.Fatalf("Expected successful logins not to be throttled, attempt %d waited %s", i+1, wait)
+			}
+
+			if err := app.loginSucceeded(ctx, res); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/robertgouveia/social/internal/auth"
+	"github.com/robertgouveia/social/internal/blob"
 	"github.com/robertgouveia/social/internal/db"
 	"github.com/robertgouveia/social/internal/env"
 	"github.com/robertgouveia/social/internal/mail"
@@ -51,8 +55,50 @@ func main() {
 			enabled: env.GetBool("REDIS_ENABLED", true),
 		},
 		env: env.GetString("ENV", "development"),
+		feed: feedConfig{
+			fanOutLimit: env.GetInt("FEED_FAN_OUT_LIMIT", 10000),
+		},
+		explore: exploreConfig{
+			window:         time.Hour * 72,
+			size:           200,
+			trendingWindow: time.Hour * 24,
+			trendingSize:   20,
+			refresh:        time.Minute * 5,
+		},
+		publisher: publisherConfig{
+			interval:  time.Second * 30,
+			batchSize: 100,
+		},
+		trash: trashConfig{
+			retention:     time.Hour * 24 * 30, // 30 days
+			purgeInterval: time.Hour,
+			batchSize:     100,
+		},
+		media: mediaConfig{
+			backend: env.GetString("MEDIA_BACKEND", "local"),
+			dir:     env.GetString("MEDIA_DIR", "./uploads"),
+			s3: blob.S3Config{
+				Endpoint:  env.GetString("S3_ENDPOINT", "http://localhost:9000"),
+				Region:    env.GetString("S3_REGION", "us-east-1"),
+				Bucket:    env.GetString("S3_BUCKET", "social"),
+				AccessKey: env.GetString("S3_ACCESS_KEY", ""),
+				SecretKey: env.GetString("S3_SECRET_KEY", ""),
+			},
+			maxSize:   10 << 20, // 10 MB
+			maxFiles:  4,
+			urlSecret: env.GetString("MEDIA_URL_SECRET", "example"),
+			urlExp:    time.Minute * 15,
+
+			workerInterval: time.Second * 10,
+			workerBatch:    10,
+			claimTimeout:   time.Minute * 10,
+		},
+		pagination: paginationConfig{
+			cursorSecret: env.GetString("PAGINATION_CURSOR_SECRET", "example"),
+		},
 		mail: mailConfig{
 			exp:       time.Hour * 24 * 3, // 3 days
+			resetExp:  time.Hour,
 			fromEmail: env.GetString("FROM_EMAIL", ""),
 			sendGrid: sendGridConfig{
 				apiKey: env.GetString("SENDGRID_API_KEY", ""),
@@ -64,9 +110,23 @@ func main() {
 				password: env.GetString("AUTH_BASIC_PASS", "admin"),
 			},
 			token: tokenConfig{
-				secret: env.GetString("AUTH_TOKEN_SECRET", "example"),
-				exp:    time.Hour * 24 * 3, // 3 days
-				iss:    "gophersocial",
+				secret:     env.GetString("AUTH_TOKEN_SECRET", "example"),
+				keyFile:    env.GetString("AUTH_TOKEN_KEY_FILE", ""),
+				kid:        env.GetString("AUTH_TOKEN_KID", ""),
+				verifyKeys: env.GetString("AUTH_TOKEN_VERIFY_KEYS", ""),
+				exp:        time.Minute * 15,
+				refreshExp: time.Hour * 24 * 7, // 7 days
+				iss:        "gophersocial",
+
+				revocationPurge: time.Hour,
+			},
+			login: loginConfig{
+				freeAttempts:       3,
+				baseDelay:          time.Second,
+				maxDelay:           time.Second * 30,
+				maxAccountFailures: env.GetInt("AUTH_LOGIN_MAX_FAILURES", 10),
+				maxIPFailures:      env.GetInt("AUTH_LOGIN_MAX_IP_FAILURES", 50),
+				lockout:            time.Minute * 15,
 			},
 		},
 	}
@@ -90,10 +150,22 @@ func main() {
 
 	store := store.NewStorage(db)
 	cacheStore := cache.NewRedisStorage(rdb)
+	if !cfg.redisCfg.enabled {
+		// still throttle logins, but per instance
+		cacheStore.LoginAttempts = cache.NewMemoryLoginAttemptStore()
+	}
 
 	mailer := mail.NewMailHog("gopher@hotmail.com")
 
-	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.iss, cfg.auth.token.iss)
+	jwtAuthenticator, err := newAuthenticator(cfg.auth.token)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	blobStore, err := newBlobStore(cfg.media)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	app := &application{
 		config:        cfg,
@@ -102,10 +174,67 @@ func main() {
 		mailer:        mailer,
 		authenticator: &jwtAuthenticator,
 		cacheStorage:  cacheStore,
+		blobStore:     blobStore,
+		mediaWake:     make(chan struct{}, 1),
 	}
 
+	if cfg.redisCfg.enabled {
+		go app.refreshExplore(context.Background())
+	} else {
+		// redis expires its revocations by itself
+		go app.purgeRevocations(context.Background())
+	}
+
+	go app.publishScheduledPosts(context.Background())
+	go app.purgeTrash(context.Background())
+	go app.processAttachments(context.Background())
+
 	mux := app.mount()
 
 	logger.Info("Server started on :3000")
 	logger.Fatal(app.run(mux))
 }
+
+func newAuthenticator(cfg tokenConfig) (auth.JWTAuthenticator, error) {
+	if cfg.keyFile == "" {
+		return auth.NewJWTAuthenticator(cfg.secret, cfg.iss, cfg.iss), nil
+	}
+
+	signer, err := auth.LoadPrivateKey(cfg.keyFile, cfg.kid)
+	if err != nil {
+		return auth.JWTAuthenticator{}, err
+	}
+
+	var verifiers []auth.Signer
+	for _, entry := range strings.Split(cfg.verifyKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// kid=path, the kid defaults to the key fingerprint
+		kid, path, found := strings.Cut(entry, "=")
+		if !found {
+			kid, path = "", entry
+		}
+
+		verifier, err := auth.LoadPublicKey(path, kid)
+		if err != nil {
+			return auth.JWTAuthenticator{}, err
+		}
+		verifiers = append(verifiers, verifier)
+	}
+
+	return auth.NewJWTAuthenticatorWithKeys(signer, verifiers, cfg.iss, cfg.iss)
+}
+
+func newBlobStore(cfg mediaConfig) (blob.BlobStore, error) {
+	switch cfg.backend {
+	case "local":
+		return blob.NewLocalStore(cfg.dir)
+	case "s3":
+		return blob.NewS3Store(cfg.s3), nil
+	default:
+		return nil, fmt.Errorf("unknown media backend %q", cfg.backend)
+	}
+}
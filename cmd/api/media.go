@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/robertgouveia/social/internal/media"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// processAttachments works through uploaded images on an interval, uploads wake it early
+func (app *application) processAttachments(ctx context.Context) {
+	ticker := time.NewTicker(app.config.media.workerInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			attachments, err := app.store.Attachments.ClaimPending(ctx, app.config.media.workerBatch, app.config.media.claimTimeout)
+			if err != nil {
+				app.logger.Errorw("error claiming attachments", "error", err)
+				break
+			}
+
+			for i := range attachments {
+				app.processAttachment(ctx, &attachments[i])
+			}
+
+			if len(attachments) < app.config.media.workerBatch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-app.mediaWake:
+		}
+	}
+}
+
+// wakeMediaWorker never blocks, a wake that's already waiting covers this one too
+func (app *application) wakeMediaWorker() {
+	select {
+	case app.mediaWake <- struct{}{}:
+	default:
+	}
+}
+
+// processAttachment replaces the upload with a stripped copy and stores its renditions. Images
+// that can't be decoded are marked failed, anything else is left claimed so it's retried
+// once the claim goes stale
+func (app *application) processAttachment(ctx context.Context, attachment *store.Attachment) {
+	body, err := app.blobStore.Get(ctx, attachment.Key)
+	if err != nil {
+		app.logger.Errorw("error reading attachment", "attachment_id", attachment.ID, "error", err)
+		return
+	}
+
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		app.logger.Errorw("error reading attachment", "attachment_id", attachment.ID, "error", err)
+		return
+	}
+
+	result, err := media.Process(data)
+	if err != nil {
+		app.logger.Warnw("error processing attachment", "attachment_id", attachment.ID, "error", err)
+		if err := app.store.Attachments.SetFailed(ctx, attachment); err != nil {
+			app.logClaimError("error marking attachment failed", attachment, err)
+		}
+		return
+	}
+
+	// overwriting the upload is safe to repeat, a retry just processes the stripped copy
+	if result.Original != nil {
+		if err := app.putRendition(ctx, attachment.Key, result.Original); err != nil {
+			app.logger.Errorw("error storing attachment", "attachment_id", attachment.ID, "error", err)
+			return
+		}
+		attachment.ContentType = result.Original.ContentType
+		attachment.Size = int64(len(result.Original.Data))
+	}
+
+	attachment.Width = &result.Width
+	attachment.Height = &result.Height
+	attachment.BlurHash = &result.BlurHash
+	attachment.Renditions = map[string]store.AttachmentRendition{}
+
+	for name, rendition := range map[string]*media.Rendition{"thumbnail": result.Thumbnail, "medium": result.Medium} {
+		if rendition == nil {
+			continue
+		}
+
+		key := fmt.Sprintf("%s-%s", attachment.Key, name)
+		if err := app.putRendition(ctx, key, rendition); err != nil {
+			app.logger.Errorw("error storing attachment rendition", "attachment_id", attachment.ID, "rendition", name, "error", err)
+			return
+		}
+
+		attachment.Renditions[name] = store.AttachmentRendition{
+			Key:         key,
+			ContentType: rendition.ContentType,
+			Width:       rendition.Width,
+			Height:      rendition.Height,
+			Size:        int64(len(rendition.Data)),
+		}
+	}
+
+	if err := app.store.Attachments.SetProcessed(ctx, attachment); err != nil {
+		app.logClaimError("error saving processed attachment", attachment, err)
+
+		// the delete only removed the blobs it knew of, the ones written above are left to clean
+		// up. A worker that took over the claim writes to the same keys, so those are kept
+		if errors.Is(err, store.ErrNotFound) {
+			keys := []string{attachment.Key}
+			for _, r := range attachment.Renditions {
+				keys = append(keys, r.Key)
+			}
+			app.deleteBlobs(keys...)
+		}
+	}
+}
+
+// logClaimError logs a failed save, losing the claim to another worker or a delete is expected
+// when processing is slow so it isn't an error
+func (app *application) logClaimError(msg string, attachment *store.Attachment, err error) {
+	if errors.Is(err, store.ErrClaimLost) || errors.Is(err, store.ErrNotFound) {
+		app.logger.Infow("attachment claim was lost", "attachment_id", attachment.ID, "reason", err)
+		return
+	}
+
+	app.logger.Errorw(msg, "attachment_id", attachment.ID, "error", err)
+}
+
+func (app *application) putRendition(ctx context.Context, key string, rendition *media.Rendition) error {
+	return app.blobStore.Put(ctx, key, bytes.NewReader(rendition.Data), int64(len(rendition.Data)), rendition.ContentType)
+}
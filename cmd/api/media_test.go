@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/robertgouveia/social/internal/blob"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// unsavedAttachmentStore refuses every processed result with err
+type unsavedAttachmentStore struct {
+	store.MockAttachmentStore
+	err error
+}
+
+func (s *unsavedAttachmentStore) SetProcessed(ctx context.Context, a *store.Attachment) error {
+	return s.err
+}
+
+func TestProcessAttachmentCleanup(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 1600, 1200))); err != nil {
+		t.Fatal(err)
+	}
+
+	process := func(t *testing.T, saveErr error) int {
+		t.Helper()
+
+		app := newTestApplication(t)
+		app.store.Attachments = &unsavedAttachmentStore{err: saveErr}
+		blobDir := t.TempDir()
+		blobStore, err := blob.NewLocalStore(blobDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.blobStore = blobStore
+
+		ctx := context.Background()
+		attachment := &store.Attachment{ID: 1, Key: "posts/1/photo", ContentType: "image/png", Status: store.AttachmentProcessing}
+		if err := blobStore.Put(ctx, attachment.Key, bytes.NewReader(img.Bytes()), int64(img.Len()), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+
+		app.processAttachment(ctx, attachment)
+
+		return countBlobs(t, blobDir)
+	}
+
+	t.Run("Should delete what it wrote for an attachment deleted meanwhile", func(t *testing.T) {
+		if n := process(t, store.ErrNotFound); n != 0 {
+			t.Errorf("Expected every blob to be deleted, %d are left", n)
+		}
+	})
+
+	t.Run("Should keep the blobs when another worker holds the claim", func(t *testing.T) {
+		// the original and both renditions, the other worker saves the same keys
+		if n := process(t, store.ErrClaimLost); n != 3 {
+			t.Errorf("Expected the 3 blobs to be kept, got %d", n)
+		}
+	})
+}
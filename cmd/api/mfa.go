@@ -0,0 +1,441 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/robertgouveia/social/internal/auth"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+const (
+	mfaChallengeType  = "mfa_challenge"
+	mfaChallengeExp   = time.Minute * 5
+	recoveryCodeCount = 10
+	totpIssuer        = "GopherSocial"
+)
+
+type mfaCodePayload struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type verifyMFAPayload struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	// one of code or recovery_code
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=20"`
+}
+
+type disableMFAPayload struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=20"`
+}
+
+type roleMFAPayload struct {
+	Required *bool `json:"required" validate:"required"`
+}
+
+type mfaChallengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int64  `json:"expires_in"`
+}
+
+type mfaEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // otpauth:// link for authenticator apps (QR code)
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// EnrollMFA godoc
+//
+//	@Summary		Starts two factor enrolment
+//	@Description	Generates a TOTP secret, it is not active until confirmed with a code
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		201	{object}	mfaEnrollmentResponse
+//	@Failure		409	{object}	error	"Two factor authentication is already enabled"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/mfa/enroll [post]
+func (app *application) enrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.Enroll(r.Context(), user.ID, secret); err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflict(w, r, fmt.Errorf("two factor authentication is already enabled"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	enrollment := &mfaEnrollmentResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(secret, totpIssuer, user.Email),
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// EnableMFA godoc
+//
+//	@Summary		Confirms two factor enrolment
+//	@Description	Enables two factor authentication and returns recovery codes, they are only shown once
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		mfaCodePayload	true	"Code from the authenticator app"
+//	@Success		200		{object}	recoveryCodesResponse
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"No pending enrolment"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/mfa/enable [post]
+func (app *application) enableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload mfaCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	mfa, err := app.store.MFA.Get(ctx, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if mfa.Enabled {
+		app.conflict(w, r, fmt.Errorf("two factor authentication is already enabled"))
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(mfa.Secret, payload.Code, time.Now())
+	if !ok {
+		app.badRequest(w, r, fmt.Errorf("invalid code"))
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	hashed := make([]string, len(codes))
+	for i, code := range codes {
+		hashed[i] = auth.HashToken(code)
+	}
+
+	if err := app.store.MFA.Enable(ctx, user.ID, step, hashed); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, &recoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DisableMFA godoc
+//
+//	@Summary		Disables two factor authentication
+//	@Description	Requires a current code or a recovery code
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	disableMFAPayload	true	"Code or recovery code"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/mfa/disable [post]
+func (app *application) disableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload disableMFAPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if err := app.verifySecondFactor(r, user.ID, payload.Code, payload.RecoveryCode); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w, r, err)
+		case errInvalidMFACode:
+			app.badRequest(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.MFA.Disable(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// VerifyMFA godoc
+//
+//	@Summary		Completes a two factor login
+//	@Description	Exchanges the challenge token from /authentication/token and a code for access and refresh tokens
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		verifyMFAPayload	true	"Challenge token and code or recovery code"
+//	@Success		201		{object}	tokenResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/mfa/verify [post]
+func (app *application) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload verifyMFAPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	challenge, err := app.authenticator.ValidateToken(payload.ChallengeToken)
+	if err != nil {
+		app.unauthorized(w, r, err)
+		return
+	}
+
+	claims, _ := challenge.Claims.(jwt.MapClaims)
+	if typ, _ := claims["typ"].(string); typ != mfaChallengeType {
+		app.unauthorized(w, r, fmt.Errorf("token is not a two factor challenge"))
+		return
+	}
+
+	userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+	if err != nil {
+		app.unauthorized(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// challenges are single use
+	revoked, err := app.isTokenRevoked(ctx, userID, claims)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if revoked {
+		app.unauthorized(w, r, fmt.Errorf("challenge has already been used"))
+		return
+	}
+
+	// codes are only 6 digits, guessing is throttled like passwords
+	mfaKey, ipKey, _ := loginThrottleKeys(fmt.Sprintf("mfa-%d", userID), r)
+	retryAfter, reservation, err := app.reserveLoginAttempt(ctx, mfaKey, ipKey)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.tooManyRequests(w, r, retryAfter)
+		return
+	}
+
+	if err := app.verifySecondFactor(r, userID, payload.Code, payload.RecoveryCode); err != nil {
+		switch err {
+		case store.ErrNotFound, errInvalidMFACode:
+			app.unauthorized(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.loginSucceeded(ctx, reservation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	exp, _ := claims.GetExpirationTime()
+	jti, _ := claims["jti"].(string)
+	if err := app.revocations().Revoke(ctx, jti, userID, exp.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens, err := app.issueTokens(ctx, userID, true)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// SetRoleMFA godoc
+//
+//	@Summary		Requires two factor authentication for a role
+//	@Description	Users with the role lose its permissions until their session has passed two factor authentication
+//	@Tags			roles
+//	@Accept			json
+//	@Produce		json
+//	@Param			role	path	string			true	"Role name"
+//	@Param			payload	body	roleMFAPayload	true	"Whether two factor authentication is required"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/roles/{role}/mfa [put]
+func (app *application) setRoleMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload roleMFAPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := app.store.Roles.SetRequireMFA(r.Context(), chi.URLParam(r, "role"), *payload.Required); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+var errInvalidMFACode = errors.New("invalid two factor code")
+
+// verifySecondFactor checks a TOTP code, falling back to a recovery code
+func (app *application) verifySecondFactor(r *http.Request, userID int64, code, recoveryCode string) error {
+	ctx := r.Context()
+
+	mfa, err := app.store.MFA.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !mfa.Enabled {
+		return store.ErrNotFound
+	}
+
+	if code != "" {
+		step, ok := auth.ValidateTOTP(mfa.Secret, code, time.Now())
+		if !ok {
+			return errInvalidMFACode
+		}
+
+		// a code can only be used once
+		if err := app.store.MFA.UseStep(ctx, userID, step); err != nil {
+			if err == store.ErrConflict {
+				return errInvalidMFACode
+			}
+			return err
+		}
+
+		return nil
+	}
+
+	normalised := strings.ToLower(strings.TrimSpace(recoveryCode))
+	if err := app.store.MFA.UseRecoveryCode(ctx, userID, auth.HashToken(normalised)); err != nil {
+		if err == store.ErrNotFound {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	app.logger.Infow("recovery code used", "user_id", userID)
+
+	return nil
+}
+
+func (app *application) generateMFAChallenge(userID int64) (*mfaChallengeResponse, error) {
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"exp": time.Now().Add(mfaChallengeExp).Unix(),
+		"iat": issuedAt(time.Now()),
+		"nbf": time.Now().Unix(),
+		"iss": app.config.auth.token.iss,
+		"aud": app.config.auth.token.iss,
+		"jti": uuid.New().String(),
+		"typ": mfaChallengeType,
+	}
+
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mfaChallengeResponse{
+		MFARequired:    true,
+		ChallengeToken: token,
+		ExpiresIn:      int64(mfaChallengeExp.Seconds()),
+	}, nil
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/robertgouveia/social/internal/auth"
 	"github.com/robertgouveia/social/internal/store"
 )
 
@@ -57,37 +61,133 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		parts := strings.Split(authHeader, " ")
-
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 {
 			app.unauthorized(w, r, fmt.Errorf("authorization is malformed"))
 			return
 		}
 
-		token := parts[1]
-
-		jwtToken, err := app.authenticator.ValidateToken(token)
-		if err != nil {
-			app.unauthorized(w, r, err)
-			return
+		switch parts[0] {
+		case "Bearer":
+			app.authenticateJWT(w, r, next, parts[1])
+		case "ApiKey":
+			app.authenticateAPIKey(w, r, next, parts[1])
+		default:
+			app.unauthorized(w, r, fmt.Errorf("authorization is malformed"))
 		}
+	})
+}
 
-		claims, _ := jwtToken.Claims.(jwt.MapClaims)
-		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
-		if err != nil {
-			app.unauthorized(w, r, err)
-			return
+func (app *application) authenticateJWT(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	jwtToken, err := app.authenticator.ValidateToken(token)
+	if err != nil {
+		app.unauthorized(w, r, err)
+		return
+	}
+
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	// mfa challenges are signed by the same key but can't be used as access tokens
+	if typ, _ := claims["typ"].(string); typ != accessTokenType {
+		app.unauthorized(w, r, fmt.Errorf("token is not an access token"))
+		return
+	}
+
+	userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+	if err != nil {
+		app.unauthorized(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// logged out tokens are still signed, so check the revocation list
+	revoked, err := app.isTokenRevoked(ctx, userID, claims)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if revoked {
+		app.unauthorized(w, r, fmt.Errorf("token has been revoked"))
+		return
+	}
+
+	user, err := app.getUser(ctx, userID)
+	if err != nil {
+		app.unauthorized(w, r, err)
+		return
+	}
+
+	ctx = context.WithValue(ctx, userCtx, user)
+	ctx = context.WithValue(ctx, claimsCtx, claims)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	ctx := r.Context()
+
+	key, err := app.store.APIKeys.GetByKey(ctx, auth.HashToken(token))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorized(w, r, fmt.Errorf("invalid api key"))
+		default:
+			app.internalServerError(w, r, err)
 		}
+		return
+	}
 
-		ctx := r.Context()
+	user, err := app.getUser(ctx, key.UserID)
+	if err != nil {
+		app.unauthorized(w, r, err)
+		return
+	}
 
-		user, err := app.getUser(ctx, userID)
-		if err != nil {
-			app.unauthorized(w, r, err)
+	// usage tracking must not fail the request
+	if err := app.store.APIKeys.Touch(ctx, key.ID); err != nil {
+		app.logger.Warnw("error recording api key usage", "key_id", key.ID, "error", err.Error())
+	}
+
+	ctx = context.WithValue(ctx, userCtx, user)
+	ctx = context.WithValue(ctx, apiKeyCtx, key)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// scopeMiddleware limits api keys to the scopes they were created with,
+// reads need <resource>:read and everything else <resource>:write.
+// Logged in sessions have every scope.
+func (app *application) scopeMiddleware(resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := getAPIKeyFromContext(r)
+			if key == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scope := resource + ":write"
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = resource + ":read"
+			}
+
+			if !slices.Contains(key.Scopes, scope) {
+				app.forbidden(w, r, fmt.Errorf("api key is missing the %s scope", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sessionOnlyMiddleware keeps api keys away from account management
+func (app *application) sessionOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getAPIKeyFromContext(r) != nil {
+			app.forbidden(w, r, fmt.Errorf("api keys can not be used for this endpoint"))
 			return
 		}
 
-		ctx = context.WithValue(ctx, userCtx, user)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r)
 	})
 }
 
@@ -113,10 +213,51 @@ func (app *application) checkPostOwnership(role string, next http.HandlerFunc) h
 			return
 		}
 
+		if !app.hasRequiredMFA(r, user) {
+			app.forbidden(w, r, fmt.Errorf("role requires two factor authentication"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkRole only lets users with at least the given role through
+func (app *application) checkRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, role)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbidden(w, r, fmt.Errorf("forbidden"))
+			return
+		}
+
+		if !app.hasRequiredMFA(r, user) {
+			app.forbidden(w, r, fmt.Errorf("role requires two factor authentication"))
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// hasRequiredMFA reports false when the users role requires two factor
+// authentication and the session did not pass it, role powers are withheld
+func (app *application) hasRequiredMFA(r *http.Request, user *store.User) bool {
+	if !user.Role.RequireMFA {
+		return true
+	}
+
+	mfa, _ := getClaimsFromContext(r)["mfa"].(bool)
+	return mfa
+}
+
 func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, role string) (bool, error) {
 	Role, err := app.store.Roles.GetByName(ctx, role)
 	if err != nil {
@@ -126,6 +267,54 @@ func (app *application) checkRolePrecedence(ctx context.Context, user *store.Use
 	return user.Role.Level >= Role.Level, nil
 }
 
+// tokenRevocations is satisfied by both the redis and postgres revocation lists
+type tokenRevocations interface {
+	Revoke(context.Context, string, int64, time.Time) error
+	IsRevoked(context.Context, string) (bool, error)
+	RevokeUser(context.Context, int64, time.Time, time.Time) error
+	UserRevokedAt(context.Context, int64) (time.Time, error)
+}
+
+func (app *application) revocations() tokenRevocations {
+	if app.config.redisCfg.enabled {
+		return app.cacheStorage.Revocations
+	}
+
+	return app.store.Revocations
+}
+
+func (app *application) isTokenRevoked(ctx context.Context, userID int64, claims jwt.MapClaims) (bool, error) {
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		// every token we issue has an id, anything else can't be revoked
+		return true, nil
+	}
+
+	revoked, err := app.revocations().IsRevoked(ctx, jti)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	// logging out of all sessions revokes everything issued up to that point
+	revokedAt, err := app.revocations().UserRevokedAt(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if revokedAt.IsZero() {
+		return false, nil
+	}
+
+	// GetIssuedAt drops everything under a second, parsed claims hold numbers as float64
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return true, nil
+	}
+
+	issued := time.UnixMicro(int64(math.Round(iat * 1e6)))
+	return !issued.After(revokedAt), nil
+}
+
 func (app *application) getUser(ctx context.Context, userID int64) (*store.User, error) {
 	if app.config.redisCfg.enabled {
 		user, err := app.cacheStorage.Users.Get(ctx, userID)
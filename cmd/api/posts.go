@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/robertgouveia/social/internal/store"
@@ -14,18 +16,40 @@ type CreatePostPayload struct {
 	Title   string   `json:"title" validate:"required,max=100"`
 	Content string   `json:"content" validate:"required,max=1000"`
 	Tags    []string `json:"tags"`
+	// public (default), followers or mentioned, mentioned posts are only seen by users @mentioned in the content
+	Visibility string `json:"visibility" validate:"omitempty,oneof=public followers mentioned"`
+	// draft or published (default), setting publish_at schedules the post instead
+	Status    string     `json:"status" validate:"omitempty,oneof=draft published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 type postKey string
 
 type UpdatePostPayload struct {
 	// values will equal "" unless a pointer reference
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title      *string `json:"title" validate:"omitempty,max=100"`
+	Content    *string `json:"content" validate:"omitempty,max=1000"`
+	Visibility *string `json:"visibility" validate:"omitempty,oneof=public followers mentioned"`
 }
 
 const postCtx postKey = "post"
 
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9_]+)`)
+
+// parseMentions finds the @usernames in a posts content
+func parseMentions(content string) []string {
+	seen := map[string]bool{}
+	mentions := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			mentions = append(mentions, match[1])
+		}
+	}
+
+	return mentions
+}
+
 // CreatePost godoc
 //
 //	@Summary		Create a post
@@ -51,13 +75,31 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if payload.PublishAt != nil {
+		if payload.Status == store.PostStatusDraft {
+			app.badRequest(w, r, errors.New("drafts can not have a publish_at"))
+			return
+		}
+
+		if !payload.PublishAt.After(time.Now()) {
+			app.badRequest(w, r, errors.New("publish_at must be in the future"))
+			return
+		}
+
+		payload.Status = store.PostStatusScheduled
+	}
+
 	user := getUserFromContext(r)
 
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  user.ID,
+		Title:      payload.Title,
+		Content:    payload.Content,
+		Tags:       payload.Tags,
+		UserID:     user.ID,
+		Visibility: payload.Visibility,
+		Mentions:   parseMentions(payload.Content),
+		Status:     payload.Status,
+		PublishAt:  payload.PublishAt,
 	}
 
 	ctx := r.Context()
@@ -66,6 +108,10 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if post.Status == store.PostStatusPublished {
+		go app.fanOutPost(post)
+	}
+
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -89,7 +135,7 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
-	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID)
+	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID, getUserFromContext(r).ID, defaultCommentsQuery)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -97,6 +143,15 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post.Comments = comments
 
+	attachments, err := app.store.Attachments.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.signAttachments(attachments)
+	post.Attachments = attachments
+
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -106,7 +161,7 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 // DeletePost godoc
 //
 //	@Summary		Deletes a post
-//	@Description	Deletes a post by ID
+//	@Description	Moves a post to the trash, the author can restore it until it's purged
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
@@ -120,7 +175,7 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
-	if err := app.store.Posts.Delete(r.Context(), post.ID); err != nil {
+	if err := app.store.Posts.Delete(r.Context(), post.ID, getUserFromContext(r).ID); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFound(w, r, err)
@@ -161,8 +216,19 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Title = *payload.Title
 	}
 
+	if payload.Visibility != nil {
+		post.Visibility = *payload.Visibility
+	}
+
+	post.Mentions = parseMentions(post.Content)
+
 	if err := app.store.Posts.Update(r.Context(), post); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflict(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -194,11 +260,58 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// posts the viewer can't see look like they don't exist, rather than forbidden
+		author, err := app.getUser(ctx, post.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFound(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		allowed, err := app.canViewPost(ctx, getUserFromContext(r), post, author)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.notFound(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// canViewPost checks the posts visibility on top of canViewPosts, moderators can see any published post
+func (app *application) canViewPost(ctx context.Context, viewer *store.User, post *store.Post, author *store.User) (bool, error) {
+	// drafts and scheduled posts are the authors alone
+	if post.Status != store.PostStatusPublished {
+		return post.UserID == viewer.ID, nil
+	}
+
+	allowed, err := app.canViewPosts(ctx, viewer, author)
+	if err != nil || !allowed {
+		return false, err
+	}
+
+	if post.Visibility == store.VisibilityPublic || post.UserID == viewer.ID {
+		return true, nil
+	}
+
+	visible, err := app.store.Posts.IsVisibleTo(ctx, post.ID, viewer.ID)
+	if err != nil || visible {
+		return visible, err
+	}
+
+	return app.checkRolePrecedence(ctx, viewer, "moderator")
+}
+
 func getPostFromCtx(r *http.Request) *store.Post {
 	post, _ := r.Context().Value(postCtx).(*store.Post)
 	return post
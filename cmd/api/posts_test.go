@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertgouveia/social/internal/store"
+)
+
+func TestGetPost(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Should hide followers only posts from non followers with a 404", func(t *testing.T) {
+		// the mock post is followers only and written by someone the test user doesn't follow
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+// publicPostStore serves public posts, post 1 is the test users own and the rest are user 7s
+type publicPostStore struct {
+	store.MockPostStore
+	updated []int64
+}
+
+func (s *publicPostStore) GetByID(ctx context.Context, postID int64) (*store.Post, error) {
+	userID := int64(7)
+	if postID == 1 {
+		userID = 42
+	}
+
+	return &store.Post{ID: postID, UserID: userID, Visibility: store.VisibilityPublic, Status: store.PostStatusPublished}, nil
+}
+
+func (s *publicPostStore) Update(ctx context.Context, post *store.Post) error {
+	s.updated = append(s.updated, post.ID)
+	return nil
+}
+
+func TestUpdatePost(t *testing.T) {
+	app := newTestApplication(t)
+	posts := &publicPostStore{}
+	app.store.Posts = posts
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(t *testing.T, path string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPatch, path, strings.NewReader(`{"visibility": "followers"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("Should not let other users update a post they can see", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, update(t, "/v1/posts/2"))
+
+		if len(posts.updated) != 0 {
+			t.Errorf("Expected no posts to be updated, got %v", posts.updated)
+		}
+	})
+
+	t.Run("Should let the owner update their post", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, update(t, "/v1/posts/1"))
+
+		if len(posts.updated) != 1 || posts.updated[0] != 1 {
+			t.Errorf("Expected post 1 to be updated, got %v", posts.updated)
+		}
+	})
+}
+
+func TestPublishPost(t *testing.T) {
+	app := newTestApplication(t)
+	app.store.Posts = &publicPostStore{}
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publish := func(t *testing.T, publishAt time.Time) int {
+		t.Helper()
+
+		body := `{"publish_at": "` + publishAt.Format(time.RFC3339) + `"}`
+		req, err := http.NewRequest(http.MethodPut, "/v1/posts/1/publish", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("Should reject a publish_at in the past", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, publish(t, time.Now().Add(-time.Hour)))
+	})
+
+	t.Run("Should schedule a publish_at in the future", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, publish(t, time.Now().Add(time.Hour)))
+	})
+}
+
+func TestPostRevisionsOwnership(t *testing.T) {
+	app := newTestApplication(t)
+	app.store.Posts = &publicPostStore{}
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// post 2 is public but belongs to someone else, the test user isn't a moderator
+	for _, path := range []string{"/v1/posts/2/revisions", "/v1/posts/2/revisions/diff?from=0&to=1", "/v1/posts/2/revisions/0"} {
+		t.Run("Should not let other users read "+path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, http.StatusForbidden, executeRequest(req, mux).Code)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// AddReaction godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Adds a reaction to a post, reacting twice with the same kind has no effect
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int		true	"Post ID"
+//	@Param			kind	path		string	true	"Reaction kind"
+//	@Success		200		{object}	map[string]int
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/reactions/{kind} [put]
+func (app *application) addReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateReaction(w, r, app.store.Reactions.Add)
+}
+
+// RemoveReaction godoc
+//
+//	@Summary		Removes a reaction from a post
+//	@Description	Removes a reaction from a post, removing a reaction that isn't there has no effect
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int		true	"Post ID"
+//	@Param			kind	path		string	true	"Reaction kind"
+//	@Success		200		{object}	map[string]int
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/reactions/{kind} [delete]
+func (app *application) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateReaction(w, r, app.store.Reactions.Remove)
+}
+
+// updateReaction applies the change and responds with the posts new counts
+func (app *application) updateReaction(w http.ResponseWriter, r *http.Request, apply func(ctx context.Context, postID, userID int64, kind string) error) {
+	kind := chi.URLParam(r, "kind")
+	if !store.IsReactionKind(kind) {
+		app.badRequest(w, r, fmt.Errorf("unknown reaction %q", kind))
+		return
+	}
+
+	user := getUserFromContext(r)
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+
+	if err := apply(ctx, post.ID, user.ID, kind); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	counts, err := app.store.Reactions.GetCounts(ctx, post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, counts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// setReactionStore keeps reactions in memory, one per user, post and kind like the unique constraint
+type setReactionStore struct {
+	store.MockReactionStore
+	reactions map[string]map[int64]bool
+}
+
+func (s *setReactionStore) Add(ctx context.Context, postID, userID int64, kind string) error {
+	if s.reactions[kind] == nil {
+		s.reactions[kind] = map[int64]bool{}
+	}
+	s.reactions[kind][userID] = true
+	return nil
+}
+
+func (s *setReactionStore) Remove(ctx context.Context, postID, userID int64, kind string) error {
+	delete(s.reactions[kind], userID)
+	return nil
+}
+
+func (s *setReactionStore) GetCounts(ctx context.Context, postID int64) (map[string]int, error) {
+	counts := map[string]int{}
+	for kind, users := range s.reactions {
+		if len(users) > 0 {
+			counts[kind] = len(users)
+		}
+	}
+	return counts, nil
+}
+
+func TestReactions(t *testing.T) {
+	app := newTestApplication(t)
+	app.store.Posts = &publicPostStore{}
+	app.store.Reactions = &setReactionStore{reactions: map[string]map[int64]bool{}}
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	react := func(t *testing.T, method, path string) (int, map[string]int) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		var body struct {
+			Data map[string]int `json:"data"`
+		}
+		if rr.Code == http.StatusOK {
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return rr.Code, body.Data
+	}
+
+	t.Run("Should count a reaction once however often it is added", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			code, counts := react(t, http.MethodPut, "/v1/posts/2/reactions/like")
+			checkResponseCode(t, http.StatusOK, code)
+
+			if counts["like"] != 1 {
+				t.Errorf("Expected 1 like and got %v", counts)
+			}
+		}
+	})
+
+	t.Run("Should allow removing a reaction that is already gone", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			code, counts := react(t, http.MethodDelete, "/v1/posts/2/reactions/like")
+			checkResponseCode(t, http.StatusOK, code)
+
+			if len(counts) != 0 {
+				t.Errorf("Expected no reactions and got %v", counts)
+			}
+		}
+	})
+
+	t.Run("Should reject an unknown kind", func(t *testing.T) {
+		code, _ := react(t, http.MethodPut, "/v1/posts/2/reactions/shrug")
+		checkResponseCode(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("Should 404 reactions to a post the user can't see", func(t *testing.T) {
+		app.store.Posts = &store.MockPostStore{}
+		mux := app.mount()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/posts/2/reactions/like", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robertgouveia/social/internal/diff"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+var defaultRevisionsQuery = store.PaginatedQuery{
+	Limit:  20,
+	Offset: 0,
+	Sort:   "desc",
+}
+
+// PostDiff is how a post changed from one version to another
+type PostDiff struct {
+	From    int         `json:"from"`
+	To      int         `json:"to"`
+	Title   []diff.Line `json:"title"`
+	Content []diff.Line `json:"content"`
+}
+
+// GetPostRevisions godoc
+//
+//	@Summary		Lists a posts revisions
+//	@Description	Lists every version of a post, including the current one, newest first by default
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int		true	"Post ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{array}		store.PostRevision
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/revisions [get]
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	pq, err := defaultRevisionsQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	revisions, err := app.store.PostRevisions.GetByPostID(r.Context(), post.ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetPostRevision godoc
+//
+//	@Summary		Gets a posts revision
+//	@Description	Gets the title and content a post had at a version
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int	true	"Post ID"
+//	@Param			version	path		int	true	"Version"
+//	@Success		200		{object}	store.PostRevision
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/revisions/{version} [get]
+func (app *application) getPostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	revision, ok := app.getRevision(w, r, version)
+	if !ok {
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revision); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DiffPostRevisions godoc
+//
+//	@Summary		Diffs two revisions of a post
+//	@Description	Line by line diff of the title and content between two versions of a post
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int	true	"Post ID"
+//	@Param			from	query		int	true	"Old version"
+//	@Param			to		query		int	true	"New version"
+//	@Success		200		{object}	PostDiff
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/revisions/diff [get]
+func (app *application) diffPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	from, err := strconv.Atoi(qs.Get("from"))
+	if err != nil {
+		app.badRequest(w, r, errors.New("from must be a version"))
+		return
+	}
+
+	to, err := strconv.Atoi(qs.Get("to"))
+	if err != nil {
+		app.badRequest(w, r, errors.New("to must be a version"))
+		return
+	}
+
+	oldRevision, ok := app.getRevision(w, r, from)
+	if !ok {
+		return
+	}
+
+	newRevision, ok := app.getRevision(w, r, to)
+	if !ok {
+		return
+	}
+
+	d := PostDiff{
+		From:    from,
+		To:      to,
+		Title:   diff.Lines(oldRevision.Title, newRevision.Title),
+		Content: diff.Lines(oldRevision.Content, newRevision.Content),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, d); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// RestorePostRevision godoc
+//
+//	@Summary		Restores a posts revision
+//	@Description	Puts back the title and content a post had at a version, as a new version
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int	true	"Post ID"
+//	@Param			version	path		int	true	"Version"
+//	@Success		200		{object}	store.Post
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/revisions/{version}/restore [put]
+func (app *application) restorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if version == post.Version {
+		app.conflict(w, r, errors.New("revision is already the current version"))
+		return
+	}
+
+	revision, ok := app.getRevision(w, r, version)
+	if !ok {
+		return
+	}
+
+	post.Title = revision.Title
+	post.Content = revision.Content
+	post.Mentions = parseMentions(post.Content)
+
+	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflict(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getRevision loads a version of the post in the context, ok is false when an error response was sent
+func (app *application) getRevision(w http.ResponseWriter, r *http.Request, version int) (*store.PostRevision, bool) {
+	revision, err := app.store.PostRevisions.GetByVersion(r.Context(), getPostFromCtx(r).ID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return revision, true
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/robertgouveia/social/internal/store"
+)
+
+var defaultSearchQuery = store.SearchQuery{
+	Limit:  20,
+	Offset: 0,
+}
+
+// SearchPosts godoc
+//
+//	@Summary		Searches posts
+//	@Description	Full text search over post titles, tags and content, best matches first. Supports "quoted phrases", or and -excluded words
+//	@Tags			search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q		query		string	true	"Query"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{array}		store.PostSearchResult
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/search [get]
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+	sq, err := defaultSearchQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	results, err := app.store.Search.Posts(r.Context(), getUserFromContext(r).ID, sq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// SearchUsers godoc
+//
+//	@Summary		Searches users
+//	@Description	Finds users whose username starts with the query
+//	@Tags			search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q		query		string	true	"Username prefix"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{array}		store.UserSearchResult
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/search/users [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	sq, err := defaultSearchQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	results, err := app.store.Search.Users(r.Context(), sq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
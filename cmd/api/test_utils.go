@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/robertgouveia/social/internal/auth"
 	"github.com/robertgouveia/social/internal/store"
 	"github.com/robertgouveia/social/internal/store/cache"
 	"go.uber.org/zap"
@@ -19,9 +20,10 @@ func newTestApplication(t *testing.T) *application {
 	mockCacheStore := cache.NewMockStorage()
 
 	return &application{
-		logger:       logger,
-		store:        mockStore,
-		cacheStorage: mockCacheStore,
+		logger:        logger,
+		store:         mockStore,
+		cacheStorage:  mockCacheStore,
+		authenticator: &auth.TestAuth{},
 	}
 }
 
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/robertgouveia/social/internal/store"
+	"github.com/robertgouveia/social/internal/store/cache"
+)
+
+// fanOutPost pushes a new post onto the cached timelines of the author and their followers.
+// Authors with more followers than the fan out limit are skipped, their followers read the feed from the database
+func (app *application) fanOutPost(post *store.Post) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	limit := app.config.feed.fanOutLimit
+	followers, err := app.store.Followers.GetFollowerIDs(ctx, post.UserID, limit+1)
+	if err != nil {
+		app.logger.Errorw("error loading followers for fan out", "post_id", post.ID, "error", err)
+		return
+	}
+
+	if len(followers) > limit {
+		return
+	}
+
+	// only the followers who were mentioned can see it
+	if post.Visibility == store.VisibilityMentioned {
+		mentioned := map[int64]bool{}
+		for _, id := range post.MentionIDs {
+			mentioned[id] = true
+		}
+
+		visible := []int64{}
+		for _, id := range followers {
+			if mentioned[id] {
+				visible = append(visible, id)
+			}
+		}
+		followers = visible
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, post.CreatedAt)
+	if err != nil {
+		app.logger.Errorw("error parsing post created_at", "post_id", post.ID, "error", err)
+		return
+	}
+
+	entry := store.TimelineEntry{PostID: post.ID, CreatedAt: createdAt}
+	if err := app.cacheStorage.Timelines.Push(ctx, append(followers, post.UserID), entry); err != nil {
+		app.logger.Errorw("error pushing post to timelines", "post_id", post.ID, "error", err)
+	}
+}
+
+// rebuildTimeline replaces a users cached timeline with the newest posts in their feed.
+// Users following a popular account are marked to read from the database instead, its
+// posts are never fanned out
+func (app *application) rebuildTimeline(userID int64) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	popular, err := app.store.Followers.FollowsPopular(ctx, userID, app.config.feed.fanOutLimit)
+	if err != nil {
+		app.logger.Errorw("error rebuilding timeline", "user_id", userID, "error", err)
+		return
+	}
+
+	if popular {
+		if err := app.cacheStorage.Timelines.SetDatabaseOnly(ctx, userID); err != nil {
+			app.logger.Errorw("error storing timeline", "user_id", userID, "error", err)
+		}
+		return
+	}
+
+	entries, err := app.store.Posts.GetTimeline(ctx, userID, cache.TimelineLength)
+	if err != nil {
+		app.logger.Errorw("error rebuilding timeline", "user_id", userID, "error", err)
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Set(ctx, userID, entries); err != nil {
+		app.logger.Errorw("error storing timeline", "user_id", userID, "error", err)
+	}
+}
+
+// getTimelineFeed serves a feed page from the cached timeline, ok is false when
+// the query needs the database or the timeline isn't built yet
+func (app *application) getTimelineFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetaData, bool) {
+	if !app.config.redisCfg.enabled {
+		return nil, false
+	}
+
+	// the timeline only holds ids in the default order, filters go to the database
+	if fq.Sort != "desc" || fq.Offset > 0 || fq.Search != "" || len(fq.Tags) > 0 || fq.Since != "" || fq.Until != "" {
+		return nil, false
+	}
+
+	if fq.Cursor != nil && fq.Cursor.Before {
+		return nil, false
+	}
+
+	entries, ok, err := app.cacheStorage.Timelines.Get(ctx, userID, fq.Cursor, fq.Limit)
+	if err != nil {
+		if !errors.Is(err, cache.ErrTimelineDatabaseOnly) {
+			app.logger.Errorw("error reading timeline", "user_id", userID, "error", err)
+		}
+		return nil, false
+	}
+
+	if !ok {
+		go app.rebuildTimeline(userID)
+		return nil, false
+	}
+
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.PostID
+	}
+
+	feed, err := app.store.Posts.GetFeedByIDs(ctx, userID, ids)
+	if err != nil {
+		app.logger.Errorw("error loading timeline posts", "user_id", userID, "error", err)
+		return nil, false
+	}
+
+	return feed, true
+}
+
+// dropTimelines deletes cached timelines after a change to who the users follow, the next read
+// rebuilds them. Rebuilding straight away could race with the read that follows the change
+func (app *application) dropTimelines(ctx context.Context, userIDs ...int64) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Delete(ctx, userIDs...); err != nil {
+		app.logger.Errorw("error deleting timelines", "user_ids", userIDs, "error", err)
+	}
+}
+
+// followed drops the followers timeline. When the follow takes the user past the fan out
+// limit their posts stop being pushed, so every follower's timeline is dropped to be rebuilt
+// from the database
+func (app *application) followed(ctx context.Context, followerID, userID int64) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	app.dropTimelines(ctx, followerID)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		limit := app.config.feed.fanOutLimit
+		followers, err := app.store.Followers.GetFollowerIDs(ctx, userID, limit+2)
+		if err != nil {
+			app.logger.Errorw("error loading followers", "user_id", userID, "error", err)
+			return
+		}
+
+		if len(followers) == limit+1 {
+			app.dropTimelines(ctx, followers...)
+		}
+	}()
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robertgouveia/social/internal/store"
+	"github.com/robertgouveia/social/internal/store/cache"
+)
+
+// recordingTimelineStore serves entries as a built timeline when it has them and records every change
+type recordingTimelineStore struct {
+	cache.MockTimelineStore
+	mu           sync.Mutex
+	entries      []store.TimelineEntry
+	databaseOnly bool
+	pushed       []int64
+	set          []int64
+	deleted      []int64
+}
+
+func (s *recordingTimelineStore) Push(ctx context.Context, userIDs []int64, entry store.TimelineEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pushed = append(s.pushed, userIDs...)
+	return nil
+}
+
+func (s *recordingTimelineStore) Get(ctx context.Context, userID int64, before *store.FeedCursor, count int) ([]store.TimelineEntry, bool, error) {
+	if s.databaseOnly {
+		return nil, false, cache.ErrTimelineDatabaseOnly
+	}
+
+	return s.entries, s.entries != nil, nil
+}
+
+func (s *recordingTimelineStore) Set(ctx context.Context, userID int64, entries []store.TimelineEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set = append(s.set, userID)
+	return nil
+}
+
+func (s *recordingTimelineStore) SetDatabaseOnly(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.databaseOnly = true
+	return nil
+}
+
+func (s *recordingTimelineStore) Delete(ctx context.Context, userIDs ...int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleted = append(s.deleted, userIDs...)
+	return nil
+}
+
+func (s *recordingTimelineStore) deletedIDs() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.deleted)
+}
+
+// countedFollowerStore gives every user followers 100 up to 100+count
+type countedFollowerStore struct {
+	store.MockFollowerStore
+	count   int
+	popular bool
+}
+
+func (s *countedFollowerStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	ids := []int64{}
+	for i := 0; i < s.count && i < limit; i++ {
+		ids = append(ids, int64(100+i))
+	}
+	return ids, nil
+}
+
+func (s *countedFollowerStore) FollowsPopular(ctx context.Context, userID int64, threshold int) (bool, error) {
+	return s.popular, nil
+}
+
+// timelinePostStore records which posts a feed was loaded for
+type timelinePostStore struct {
+	store.MockPostStore
+	loaded []int64
+}
+
+func (s *timelinePostStore) GetFeedByIDs(ctx context.Context, userID int64, postIDs []int64) ([]store.PostWithMetaData, error) {
+	s.loaded = postIDs
+	return []store.PostWithMetaData{}, nil
+}
+
+func newTimelineTestApplication(t *testing.T, followers int) (*application, *recordingTimelineStore) {
+	t.Helper()
+
+	app := newTestApplication(t)
+	app.config.redisCfg.enabled = true
+	app.config.feed.fanOutLimit = 3
+	app.store.Followers = &countedFollowerStore{count: followers}
+
+	timelines := &recordingTimelineStore{}
+	app.cacheStorage.Timelines = timelines
+
+	return app, timelines
+}
+
+func TestFanOutPost(t *testing.T) {
+	post := func(visibility string, mentions ...int64) *store.Post {
+		return &store.Post{ID: 1, UserID: 42, Visibility: visibility, MentionIDs: mentions, CreatedAt: time.Now().Format(time.RFC3339)}
+	}
+
+	t.Run("Should push to the author and their followers", func(t *testing.T) {
+		app, timelines := newTimelineTestApplication(t, 3)
+		app.fanOutPost(post(store.VisibilityPublic))
+
+		if want := []int64{100, 101, 102, 42}; !slices.Equal(timelines.pushed, want) {
+			t.Errorf("Expected the post pushed to %v and got %v", want, timelines.pushed)
+		}
+	})
+
+	t.Run("Should only push mentioned posts to mentioned followers", func(t *testing.T) {
+		app, timelines := newTimelineTestApplication(t, 3)
+		app.fanOutPost(post(store.VisibilityMentioned, 101, 500))
+
+		if want := []int64{101, 42}; !slices.Equal(timelines.pushed, want) {
+			t.Errorf("Expected the post pushed to %v and got %v", want, timelines.pushed)
+		}
+	})
+
+	t.Run("Should skip authors past the fan out limit", func(t *testing.T) {
+		app, timelines := newTimelineTestApplication(t, 4)
+		app.fanOutPost(post(store.VisibilityPublic))
+
+		if len(timelines.pushed) != 0 {
+			t.Errorf("Expected nothing to be pushed and got %v", timelines.pushed)
+		}
+	})
+}
+
+func TestGetTimelineFeed(t *testing.T) {
+	ctx := context.Background()
+	fq := store.PaginatedFeedQuery{Limit: 20, Sort: "desc"}
+
+	t.Run("Should load the timelines posts", func(t *testing.T) {
+		app, timelines := newTimelineTestApplication(t, 0)
+		posts := &timelinePostStore{}
+		app.store.Posts = posts
+		timelines.entries = []store.TimelineEntry{{PostID: 3}, {PostID: 2}}
+
+		if _, ok := app.getTimelineFeed(ctx, 42, fq); !ok {
+			t.Fatal("Expected the feed to be served from the timeline")
+		}
+
+		if want := []int64{3, 2}; !slices.Equal(posts.loaded, want) {
+			t.Errorf("Expected posts %v and got %v", want, posts.loaded)
+		}
+	})
+
+	t.Run("Should fall back to the database for filtered feeds", func(t *testing.T) {
+		app, timelines := newTimelineTestApplication(t, 0)
+		timelines.entries = []store.TimelineEntry{{PostID: 3}}
+
+		filtered := fq
+		filtered.Tags = []string{"go"}
+
+		if _, ok := app.getTimelineFeed(ctx, 42, filtered); ok {
+			t.Error("Expected a filtered feed to be read from the database")
+		}
+	})
+
+	t.Run("Should fall back to the database for users following a popular account", func(t *testing.T) {
+		app, timelines := newTimelineTestApplication(t, 0)
+		app.store.Followers = &countedFollowerStore{popular: true}
+
+		app.rebuildTimeline(42)
+
+		if len(timelines.set) != 0 {
+			t.Errorf("Expected no timeline to be built and got %v", timelines.set)
+		}
+
+		if _, ok := app.getTimelineFeed(ctx, 42, fq); ok {
+			t.Error("Expected the feed to be read from the database")
+		}
+	})
+
+	t.Run("Should rebuild a missing timeline", func(t *testing.T) {
+		app, timelines := newTimelineTestApplication(t, 0)
+
+		app.rebuildTimeline(42)
+
+		if !slices.Equal(timelines.set, []int64{42}) {
+			t.Errorf("Expected user 42s timeline to be built and got %v", timelines.set)
+		}
+	})
+}
+
+func TestFollowedDropsTimelines(t *testing.T) {
+	ctx := context.Background()
+
+	waitForDeleted := func(t *testing.T, timelines *recordingTimelineStore, want []int64) {
+		t.Helper()
+
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if slices.Equal(timelines.deletedIDs(), want) {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+
+		t.Errorf("Expected timelines %v to be dropped and got %v", want, timelines.deletedIDs())
+	}
+
+	t.Run("Should drop the followers timeline", func(t *testing.T) {
+		app, timelines := newTimelineTestApplication(t, 2)
+		app.followed(ctx, 42, 7)
+
+		waitForDeleted(t, timelines, []int64{42})
+	})
+
+	t.Run("Should drop every followers timeline once the user passes the fan out limit", func(t *testing.T) {
+		app, timelines := newTimelineTestApplication(t, 4)
+		app.followed(ctx, 42, 7)
+
+		waitForDeleted(t, timelines, []int64{42, 100, 101, 102, 103})
+	})
+}
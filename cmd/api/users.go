@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -15,15 +17,17 @@ type FollowUser struct {
 
 const userCtx userKey = "users"
 
+var errInvalidUserID = errors.New("invalid user id")
+
 // GetUser godoc
 //
 //	@Summary		Fetches a user profile
-//	@Description	Fetches a user profile by ID
+//	@Description	Fetches a user profile by ID, with their post and follow counts
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"User ID"
-//	@Success		200	{object}	store.User
+//	@Success		200	{object}	store.UserProfile
 //	@Failure		400	{object}	error
 //	@Failure		404	{object}	error
 //	@Failure		500	{object}	error
@@ -32,7 +36,7 @@ const userCtx userKey = "users"
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil || userID < 1 {
-		app.badRequest(w, r, err)
+		app.badRequest(w, r, errInvalidUserID)
 		return
 	}
 
@@ -49,21 +53,91 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	stats, err := app.store.Users.GetProfileStats(ctx, user.ID, getUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	profile := store.UserProfile{User: *user, ProfileStats: *stats}
+
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
+// GetUserPosts godoc
+//
+//	@Summary		Lists a users posts
+//	@Description	Lists the posts a user has written, paged the same way as the feed
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Search"
+//	@Param			since	query		string	false	"Since, UTC (YYYY-MM-DD HH:MM:SS)"
+//	@Param			until	query		string	false	"Until, UTC (YYYY-MM-DD HH:MM:SS)"
+//	@Success		200		{array}		store.PostWithMetaData
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/posts [get]
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil || userID < 1 {
+		app.badRequest(w, r, errInvalidUserID)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.getUser(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	allowed, err := app.canViewPosts(ctx, getUserFromContext(r), user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// the same as a missing post, a private account doesn't confirm it has any
+	if !allowed {
+		app.notFound(w, r, store.ErrNotFound)
+		return
+	}
+
+	app.postsPage(w, r, func(ctx context.Context, fq store.PaginatedFeedQuery) ([]store.PostWithMetaData, error) {
+		return app.store.Posts.GetByUserID(ctx, user.ID, getUserFromContext(r).ID, fq)
+	})
+}
+
 // FollowUser godoc
 //
 //	@Summary		Follows a user
-//	@Description	Follows a user profile by ID
+//	@Description	Follows a user profile by ID, private accounts get a follow request to approve instead
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int		true	"User ID"
 //	@Success		204	{string}	string	"User followed"
+//	@Success		202	{string}	string	"Follow requested"
 //	@Failure		400	{object}	error	"User not found"
+//	@Failure		403	{object}	error
+//	@Failure		409	{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/{id}/follow [put]
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -76,17 +150,39 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 
 	ctx := r.Context()
 
+	target, err := app.getUser(ctx, followedUser)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFound(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if target.IsPrivate && target.ID != followUser.ID {
+		app.requestFollow(w, r, followUser, target)
+		return
+	}
+
 	if err := app.store.Followers.Follow(ctx, followUser.ID, followedUser); err != nil {
 		switch err {
 		case store.ErrConflict:
 			app.conflict(w, r, err)
 			return
+		case store.ErrBlocked:
+			app.forbidden(w, r, err)
+			return
 		default:
 			app.internalServerError(w, r, err)
 			return
 		}
 	}
 
+	app.followed(ctx, followUser.ID, followedUser)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -117,7 +213,19 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 	if err := app.store.Followers.Unfollow(ctx, unfollowedUser.ID, followedUser); err != nil {
 		switch err {
 		case store.ErrNotFound:
-			app.notFound(w, r, err)
+			// not following yet, cancel the pending request instead
+			if err := app.store.FollowRequests.Delete(ctx, unfollowedUser.ID, followedUser); err != nil {
+				switch err {
+				case store.ErrNotFound:
+					app.notFound(w, r, err)
+				default:
+					app.internalServerError(w, r, err)
+				}
+				return
+			}
+			if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+				app.internalServerError(w, r, err)
+			}
 			return
 		default:
 			app.internalServerError(w, r, err)
@@ -125,6 +233,8 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	app.dropTimelines(ctx, unfollowedUser.ID)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
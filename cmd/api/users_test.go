@@ -39,6 +39,30 @@ func TestGetUser(t *testing.T) {
 	})
 }
 
+func TestInvalidUserID(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/v1/users/0", "/v1/users/0/posts", "/v1/users/-1/posts", "/v1/users/abc/posts", "/v1/users/0/followers", "/v1/users/0/following"} {
+		t.Run(path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		})
+	}
+}
+
 func checkResponseCode(t *testing.T, expected, actual int) {
 	if expected != actual {
 		t.Errorf("Expected response code to be %d and got %d", expected, actual)
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigserial PRIMARY KEY,
+    token bytea NOT NULL UNIQUE,
+    user_id bigint NOT NULL,
+    family_id uuid NOT NULL,
+    expiry TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL,
+        used_at TIMESTAMP(0)
+    WITH
+        TIME ZONE,
+        revoked_at TIMESTAMP(0)
+    WITH
+        TIME ZONE,
+        created_at TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL DEFAULT NOW(),
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
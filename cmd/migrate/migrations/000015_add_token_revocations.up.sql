@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti uuid PRIMARY KEY,
+    user_id bigint NOT NULL,
+    expiry TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL,
+        created_at TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL DEFAULT NOW(),
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+-- every token issued before revoked_at is no longer valid
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id bigint PRIMARY KEY,
+    revoked_at TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL,
+        expiry TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
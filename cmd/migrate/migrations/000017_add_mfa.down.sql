@@ -0,0 +1,9 @@
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS mfa;
+
+ALTER TABLE roles DROP COLUMN IF EXISTS require_mfa;
+
+DROP INDEX IF EXISTS idx_mfa_recovery_codes_user_id;
+
+DROP TABLE IF EXISTS mfa_recovery_codes;
+
+DROP TABLE IF EXISTS user_mfa;
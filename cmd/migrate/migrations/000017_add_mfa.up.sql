@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id bigint PRIMARY KEY,
+    secret text NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    -- last accepted time step, stops a code being replayed
+    last_step bigint NOT NULL DEFAULT 0,
+    created_at TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL DEFAULT NOW(),
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    code bytea NOT NULL,
+    used_at TIMESTAMP(0)
+    WITH
+        TIME ZONE,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+
+ALTER TABLE roles
+ADD COLUMN require_mfa BOOLEAN NOT NULL DEFAULT FALSE;
+-- sessions refreshed after a second factor stay second factor sessions
+ALTER TABLE refresh_tokens
+ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT FALSE;
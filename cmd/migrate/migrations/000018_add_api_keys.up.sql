@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    -- first characters of the key, lets users tell their keys apart
+    prefix VARCHAR(16) NOT NULL,
+    key bytea NOT NULL UNIQUE,
+    scopes VARCHAR(50) [] NOT NULL,
+    expiry TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL,
+        last_used_at TIMESTAMP(0)
+    WITH
+        TIME ZONE,
+        revoked_at TIMESTAMP(0)
+    WITH
+        TIME ZONE,
+        created_at TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL DEFAULT NOW(),
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
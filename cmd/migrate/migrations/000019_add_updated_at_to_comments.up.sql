@@ -0,0 +1,4 @@
+ALTER TABLE comments
+ADD COLUMN updated_at TIMESTAMP(0)
+WITH
+    TIME ZONE NOT NULL DEFAULT NOW();
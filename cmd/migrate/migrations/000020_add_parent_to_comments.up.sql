@@ -0,0 +1,6 @@
+ALTER TABLE comments
+ADD COLUMN parent_id bigint REFERENCES comments (id) ON DELETE CASCADE;
+-- 0 for top level comments, stored so the max depth check is a single lookup
+ALTER TABLE comments ADD COLUMN depth INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id, created_at, id);
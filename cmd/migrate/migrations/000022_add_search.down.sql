@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_users_username_trgm;
+
+DROP INDEX IF EXISTS idx_posts_search;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS search;
+
+DROP FUNCTION IF EXISTS tags_to_text;
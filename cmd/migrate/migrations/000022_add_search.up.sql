@@ -0,0 +1,18 @@
+-- array_to_string isn't immutable, which generated columns require
+CREATE OR REPLACE FUNCTION tags_to_text(tags VARCHAR(100) []) RETURNS text
+LANGUAGE sql IMMUTABLE AS $$
+    SELECT COALESCE(array_to_string(tags, ' '), '')
+$$;
+
+-- weighted so matches in the title rank above tags, and tags above content
+ALTER TABLE posts
+ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('english', tags_to_text(tags)), 'B') ||
+    setweight(to_tsvector('english', COALESCE(content, '')), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING gin (search);
+
+-- username prefix search
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
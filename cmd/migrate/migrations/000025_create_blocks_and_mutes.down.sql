@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS user_mutes;
+
+DROP INDEX IF EXISTS idx_user_blocks_blocked_id;
+
+DROP TABLE IF EXISTS user_blocks;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id bigint NOT NULL,
+    blocked_id bigint NOT NULL,
+    created_at TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (blocker_id, blocked_id),
+        FOREIGN KEY (blocker_id) REFERENCES users (id) ON DELETE CASCADE,
+        FOREIGN KEY (blocked_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- blocks are checked both ways
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked_id ON user_blocks (blocked_id);
+
+CREATE TABLE IF NOT EXISTS user_mutes (
+    muter_id bigint NOT NULL,
+    muted_id bigint NOT NULL,
+    created_at TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (muter_id, muted_id),
+        FOREIGN KEY (muter_id) REFERENCES users (id) ON DELETE CASCADE,
+        FOREIGN KEY (muted_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- the title and content a post had at each version before it was edited,
+-- the current version stays on the post
+CREATE TABLE IF NOT EXISTS post_revisions (
+    post_id bigint NOT NULL,
+    version INT NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    created_at TIMESTAMP(0)
+    WITH
+        TIME ZONE NOT NULL,
+        PRIMARY KEY (post_id, version),
+        FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
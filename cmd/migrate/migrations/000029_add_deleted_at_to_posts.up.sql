@@ -0,0 +1,13 @@
+ALTER TABLE posts
+ADD COLUMN deleted_at TIMESTAMP(0)
+WITH
+    TIME ZONE;
+
+-- who deleted the post, only posts the author deleted can be restored by them
+ALTER TABLE posts
+ADD COLUMN deleted_by bigint REFERENCES users (id) ON DELETE SET NULL;
+
+-- the trash and the purge job only look at deleted posts
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at)
+WHERE
+    deleted_at IS NOT NULL;
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS attachment_renditions;
+
+DROP INDEX IF EXISTS idx_attachments_unprocessed;
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS claimed_at;
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS blurhash;
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS height;
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS width;
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS status;
@@ -0,0 +1,38 @@
+-- images are pending until the media worker has processed them, everything else is ready straight away
+ALTER TABLE attachments
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'ready' CHECK (
+    status IN (
+        'pending',
+        'processing',
+        'ready',
+        'failed'
+    )
+);
+
+ALTER TABLE attachments ADD COLUMN width INT;
+
+ALTER TABLE attachments ADD COLUMN height INT;
+
+ALTER TABLE attachments ADD COLUMN blurhash VARCHAR(64);
+
+-- when a worker took the attachment, so ones left by a crashed worker can be retried
+ALTER TABLE attachments
+ADD COLUMN claimed_at TIMESTAMP(0)
+WITH
+    TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_unprocessed ON attachments (id)
+WHERE
+    status IN ('pending', 'processing');
+
+CREATE TABLE IF NOT EXISTS attachment_renditions (
+    attachment_id bigint NOT NULL,
+    name VARCHAR(20) NOT NULL,
+    key text NOT NULL UNIQUE,
+    content_type VARCHAR(100) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size bigint NOT NULL,
+    PRIMARY KEY (attachment_id, name),
+    FOREIGN KEY (attachment_id) REFERENCES attachments (id) ON DELETE CASCADE
+);
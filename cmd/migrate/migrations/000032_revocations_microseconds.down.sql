@@ -0,0 +1,2 @@
+ALTER TABLE user_token_revocations
+ALTER COLUMN revoked_at TYPE TIMESTAMP(0) WITH TIME ZONE;
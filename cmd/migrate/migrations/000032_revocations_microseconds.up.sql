@@ -0,0 +1,3 @@
+-- access tokens carry iat to the microsecond, so a token issued right after logging out everywhere isn't caught by it
+ALTER TABLE user_token_revocations
+ALTER COLUMN revoked_at TYPE TIMESTAMP(6) WITH TIME ZONE;
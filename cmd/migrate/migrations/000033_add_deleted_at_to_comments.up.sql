@@ -0,0 +1,5 @@
+-- comments with replies are blanked instead of deleted, so the replies keep their thread
+ALTER TABLE comments
+ADD COLUMN deleted_at TIMESTAMP(0)
+WITH
+    TIME ZONE;
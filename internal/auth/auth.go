@@ -7,4 +7,5 @@ import (
 type Authenticator interface {
 	GenerateToken(jwt.Claims) (string, error)
 	ValidateToken(string) (*jwt.Token, error)
+	JWKS() JWKSet
 }
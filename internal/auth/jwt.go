@@ -2,27 +2,56 @@ package auth
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type JWTAuthenticator struct {
-	secret string
-	aud    string //audience
-	iss    string //issuer
+	signer  Signer            // active key, every new token is signed with it
+	keys    map[string]Signer // verification keys by kid, includes the signer
+	methods []string
+	aud     string //audience
+	iss     string //issuer
 }
 
 func NewJWTAuthenticator(secret, aud, iss string) JWTAuthenticator {
-	return JWTAuthenticator{
-		secret: secret,
+	a, _ := NewJWTAuthenticatorWithKeys(NewHMACSigner(secret), nil, aud, iss)
+	return a
+}
+
+// NewJWTAuthenticatorWithKeys signs with signer and additionally accepts tokens
+// signed by any of verifiers, which lets keys be rotated without logging everyone out
+func NewJWTAuthenticatorWithKeys(signer Signer, verifiers []Signer, aud, iss string) (JWTAuthenticator, error) {
+	if signer.SigningKey() == nil {
+		return JWTAuthenticator{}, fmt.Errorf("signing key %q has no private key", signer.KeyID())
+	}
+
+	a := JWTAuthenticator{
+		signer: signer,
+		keys:   map[string]Signer{},
 		aud:    aud,
 		iss:    iss,
 	}
+
+	for _, s := range append([]Signer{signer}, verifiers...) {
+		if _, ok := a.keys[s.KeyID()]; ok {
+			return JWTAuthenticator{}, fmt.Errorf("duplicate key id %q", s.KeyID())
+		}
+		a.keys[s.KeyID()] = s
+		a.methods = appendMethod(a.methods, s.Method().Alg())
+	}
+
+	return a, nil
 }
 
 func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(a.secret))
+	token := jwt.NewWithClaims(a.signer.Method(), claims)
+	if kid := a.signer.KeyID(); kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	tokenString, err := token.SignedString(a.signer.SigningKey())
 	if err != nil {
 		return "", err
 	}
@@ -32,17 +61,48 @@ func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 
 func (a *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		// tokens without a kid were signed by the shared secret
+		kid, _ := t.Header["kid"].(string)
+
+		key, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		// stops a token choosing a different algorithm for a known key
+		if t.Method.Alg() != key.Method().Alg() {
 			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
 		}
 
-		return []byte(a.secret), nil
+		return key.VerificationKey(), nil
 	},
 		jwt.WithExpirationRequired(),
 		jwt.WithAudience(a.aud),
-		jwt.WithIssuer(a.aud),
-		jwt.WithValidMethods([]string{
-			jwt.SigningMethodHS256.Name,
-		}),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidMethods(a.methods),
 	)
 }
+
+// JWKS lists the public verification keys, shared secrets are never included
+func (a *JWTAuthenticator) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, s := range a.keys {
+		if jwk, ok := s.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+
+	return set
+}
+
+func appendMethod(methods []string, alg string) []string {
+	for _, m := range methods {
+		if m == alg {
+			return methods
+		}
+	}
+
+	return append(methods, alg)
+}
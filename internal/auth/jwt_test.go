@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testTokenClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": int64(42),
+		"aud": "test",
+		"iss": "test",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+// writeKeyPair writes the private key as PKCS#8 and the public key as PKIX PEM files
+func writeKeyPair(t *testing.T, private crypto.PrivateKey, public crypto.PublicKey) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePath := filepath.Join(dir, "private.pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	der, err = x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPath := filepath.Join(dir, "public.pem")
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return privatePath, publicPath
+}
+
+func newRSAKeyPair(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writeKeyPair(t, key, &key.PublicKey)
+}
+
+func newEdKeyPair(t *testing.T) (string, string) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writeKeyPair(t, private, public)
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	rsaPrivate, _ := newRSAKeyPair(t)
+	edPrivate, _ := newEdKeyPair(t)
+
+	cases := []struct {
+		name string
+		path string
+		alg  string
+	}{
+		{"RS256", rsaPrivate, "RS256"},
+		{"EdDSA", edPrivate, "EdDSA"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			signer, err := LoadPrivateKey(c.path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			a, err := NewJWTAuthenticatorWithKeys(signer, nil, "test", "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := a.GenerateToken(testTokenClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := a.ValidateToken(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if parsed.Header["alg"] != c.alg {
+				t.Errorf("Expected alg %s and got %v", c.alg, parsed.Header["alg"])
+			}
+
+			if parsed.Header["kid"] != signer.KeyID() || signer.KeyID() == "" {
+				t.Errorf("Expected kid %q and got %v", signer.KeyID(), parsed.Header["kid"])
+			}
+		})
+	}
+
+	t.Run("HS256", func(t *testing.T) {
+		a := NewJWTAuthenticator("secret", "test", "test")
+
+		token, err := a.GenerateToken(testTokenClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := a.ValidateToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := parsed.Header["kid"]; ok {
+			t.Error("Expected shared secret tokens to have no kid")
+		}
+	})
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	oldPrivate, oldPublic := newRSAKeyPair(t)
+	newPrivate, _ := newEdKeyPair(t)
+
+	oldSigner, err := LoadPrivateKey(oldPrivate, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := NewJWTAuthenticatorWithKeys(oldSigner, nil, "test", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken, err := before.GenerateToken(testTokenClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSigner, err := LoadPrivateKey(newPrivate, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := LoadPublicKey(oldPublic, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if verifier.SigningKey() != nil {
+		t.Error("Expected a public key to be unable to sign")
+	}
+
+	after, err := NewJWTAuthenticatorWithKeys(newSigner, []Signer{verifier}, "test", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Should accept tokens signed by the previous key", func(t *testing.T) {
+		if _, err := after.ValidateToken(oldToken); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Should reject tokens signed by a key that was dropped", func(t *testing.T) {
+		dropped, err := NewJWTAuthenticatorWithKeys(newSigner, nil, "test", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := dropped.ValidateToken(oldToken); err == nil {
+			t.Error("Expected a token with an unknown kid to be rejected")
+		}
+	})
+
+	t.Run("Should not sign with a verification only key", func(t *testing.T) {
+		if _, err := NewJWTAuthenticatorWithKeys(verifier, nil, "test", "test"); err == nil {
+			t.Error("Expected an error for a signer without a private key")
+		}
+	})
+
+	t.Run("Should publish both public keys", func(t *testing.T) {
+		set := after.JWKS()
+		if len(set.Keys) != 2 {
+			t.Fatalf("Expected 2 keys and got %d", len(set.Keys))
+		}
+
+		// sorted by kid
+		if set.Keys[0].Kid != "new" || set.Keys[0].Kty != "OKP" || set.Keys[0].Crv != "Ed25519" || set.Keys[0].X == "" {
+			t.Errorf("Unexpected Ed25519 key %+v", set.Keys[0])
+		}
+
+		if set.Keys[1].Kid != "old" || set.Keys[1].Kty != "RSA" || set.Keys[1].Alg != "RS256" || set.Keys[1].N == "" || set.Keys[1].E != "AQAB" {
+			t.Errorf("Unexpected RSA key %+v", set.Keys[1])
+		}
+	})
+}
+
+func TestJWTRejectsAlgorithmMismatch(t *testing.T) {
+	rsaPrivate, rsaPublic := newRSAKeyPair(t)
+
+	signer, err := LoadPrivateKey(rsaPrivate, "rsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewJWTAuthenticatorWithKeys(signer, []Signer{NewHMACSigner("secret")}, "test", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Should reject HS256 signed with the public key", func(t *testing.T) {
+		publicPEM, err := os.ReadFile(rsaPublic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, testTokenClaims())
+		token.Header["kid"] = "rsa"
+		forged, err := token.SignedString(publicPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := a.ValidateToken(forged); err == nil {
+			t.Error("Expected a token using another algorithm for the key to be rejected")
+		}
+	})
+
+	t.Run("Should reject unsigned tokens", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, testTokenClaims())
+		unsigned, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := a.ValidateToken(unsigned); err == nil {
+			t.Error("Expected an alg none token to be rejected")
+		}
+	})
+
+	t.Run("Should reject an unknown kid", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, testTokenClaims())
+		token.Header["kid"] = "missing"
+		signed, err := token.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := a.ValidateToken(signed); err == nil {
+			t.Error("Expected a token with an unknown kid to be rejected")
+		}
+	})
+}
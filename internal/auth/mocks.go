@@ -16,6 +16,9 @@ var testClaims = jwt.MapClaims{
 	"iss": "test-aud",
 	"sub": int64(42),
 	"exp": time.Now().Add(time.Hour).Unix(),
+	"iat": time.Now().Unix(),
+	"jti": "3b241101-e2bb-4255-8caf-4136c566a962",
+	"typ": "access",
 }
 
 func (a *TestAuth) GenerateToken(claims jwt.Claims) (string, error) {
@@ -31,3 +34,7 @@ func (a *TestAuth) ValidateToken(token string) (*jwt.Token, error) {
 		return []byte(secret), nil
 	})
 }
+
+func (a *TestAuth) JWKS() JWKSet {
+	return JWKSet{Keys: []JWK{}}
+}
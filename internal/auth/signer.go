@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signer is a single key pair used to sign or verify tokens,
+// the kid header on a token decides which signer verifies it
+type Signer interface {
+	KeyID() string
+	Method() jwt.SigningMethod
+	// SigningKey is nil for signers which can only verify
+	SigningKey() any
+	VerificationKey() any
+	// JWK reports false for keys which must not be published
+	JWK() (JWK, bool)
+}
+
+// HMAC
+
+type hmacSigner struct {
+	secret []byte
+}
+
+// NewHMACSigner is the shared secret HS256 signer, tokens it signs carry no kid
+func NewHMACSigner(secret string) Signer {
+	return &hmacSigner{secret: []byte(secret)}
+}
+
+func (s *hmacSigner) KeyID() string             { return "" }
+func (s *hmacSigner) Method() jwt.SigningMethod { return jwt.SigningMethodHS256 }
+func (s *hmacSigner) SigningKey() any           { return s.secret }
+func (s *hmacSigner) VerificationKey() any      { return s.secret }
+func (s *hmacSigner) JWK() (JWK, bool)          { return JWK{}, false }
+
+// RSA
+
+type rsaSigner struct {
+	kid     string
+	private *rsa.PrivateKey
+	public  *rsa.PublicKey
+}
+
+func (s *rsaSigner) KeyID() string             { return s.kid }
+func (s *rsaSigner) Method() jwt.SigningMethod { return jwt.SigningMethodRS256 }
+func (s *rsaSigner) VerificationKey() any      { return s.public }
+
+func (s *rsaSigner) SigningKey() any {
+	if s.private == nil {
+		return nil
+	}
+	return s.private
+}
+
+func (s *rsaSigner) JWK() (JWK, bool) {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: s.Method().Alg(),
+		Kid: s.kid,
+		N:   base64.RawURLEncoding.EncodeToString(s.public.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.public.E)).Bytes()),
+	}, true
+}
+
+// EdDSA
+
+type edSigner struct {
+	kid     string
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func (s *edSigner) KeyID() string             { return s.kid }
+func (s *edSigner) Method() jwt.SigningMethod { return jwt.SigningMethodEdDSA }
+func (s *edSigner) VerificationKey() any      { return s.public }
+
+func (s *edSigner) SigningKey() any {
+	if s.private == nil {
+		return nil
+	}
+	return s.private
+}
+
+func (s *edSigner) JWK() (JWK, bool) {
+	return JWK{
+		Kty: "OKP",
+		Use: "sig",
+		Alg: s.Method().Alg(),
+		Kid: s.kid,
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(s.public),
+	}, true
+}
+
+// LoadPrivateKey reads a PKCS#8 (or PKCS#1 for RSA) PEM file, the algorithm is
+// taken from the key type. An empty kid is replaced with a fingerprint of the public key.
+func LoadPrivateKey(path, kid string) (Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key crypto.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key %s: %w", path, err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return newSigner(kid, k, &k.PublicKey)
+	case ed25519.PrivateKey:
+		return newSigner(kid, k, k.Public())
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T in %s", key, path)
+	}
+}
+
+// LoadPublicKey reads a PKIX PEM file for a key which only verifies tokens,
+// such as the previous key during a rotation
+func LoadPublicKey(path, kid string) (Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key %s: %w", path, err)
+	}
+
+	return newSigner(kid, nil, key)
+}
+
+func newSigner(kid string, private crypto.PrivateKey, public crypto.PublicKey) (Signer, error) {
+	if kid == "" {
+		fingerprint, err := keyFingerprint(public)
+		if err != nil {
+			return nil, err
+		}
+		kid = fingerprint
+	}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		s := &rsaSigner{kid: kid, public: pub}
+		if private != nil {
+			s.private = private.(*rsa.PrivateKey)
+		}
+		return s, nil
+	case ed25519.PublicKey:
+		s := &edSigner{kid: kid, public: pub}
+		if private != nil {
+			s.private = private.(ed25519.PrivateKey)
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+}
+
+func keyFingerprint(public crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	return block, nil
+}
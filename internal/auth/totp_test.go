@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 secret, truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, c := range cases {
+		at := time.Unix(c.unix, 0)
+
+		step, ok := ValidateTOTP(secret, c.code, at)
+		if !ok {
+			t.Errorf("Expected code %s to be valid at %d", c.code, c.unix)
+			continue
+		}
+
+		if step != c.unix/30 {
+			t.Errorf("Expected step %d and got %d", c.unix/30, step)
+		}
+	}
+
+	t.Run("Should reject codes outside the skew window", func(t *testing.T) {
+		if _, ok := ValidateTOTP(secret, "287082", time.Unix(59+90, 0)); ok {
+			t.Error("Expected code to be rejected")
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore keeps the bytes of uploaded files, the database only stores their keys.
+// Keys are slash separated paths such as posts/1/abc
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get returns ErrNotFound when there is no blob with the key, the caller closes the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete is idempotent, deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,30 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	cases := []struct {
+		name     string
+		old, new string
+		want     []Line
+	}{
+		{"unchanged", "a\nb", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"empty", "", "", []Line{}},
+		{"added", "", "a", []Line{{Insert, "a"}}},
+		{"removed", "a\nb", "a", []Line{{Equal, "a"}, {Delete, "b"}}},
+		{"replaced", "a\nb\nc", "a\nx\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}}},
+		{"windows line endings", "a\r\nb", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := Lines(c.old, c.new)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Expected %v, got %v", c.want, got)
+			}
+		})
+	}
+}
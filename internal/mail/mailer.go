@@ -3,9 +3,11 @@ package mail
 import "embed"
 
 const (
-	FromName            = "GopherSocial"
-	MaxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName                = "GopherSocial"
+	MaxRetries              = 3
+	UserWelcomeTemplate     = "user_invitation.tmpl"
+	PasswordResetTemplate   = "password_reset.tmpl"
+	SuspiciousLoginTemplate = "suspicious_login.tmpl"
 )
 
 //go:embed "templates"
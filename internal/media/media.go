@@ -0,0 +1,126 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the decoder
+	"image/jpeg"
+	"image/png"
+)
+
+// MaxPixels guards against decompression bombs, images are checked before they're decoded
+const MaxPixels = 50_000_000
+
+// the longest edge of each rendition
+const (
+	ThumbnailSize = 320
+	MediumSize    = 1280
+)
+
+var ErrTooLarge = errors.New("image has too many pixels")
+
+// Rendition is an encoded version of an image
+type Rendition struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+type Result struct {
+	// dimensions of the image the right way up
+	Width  int
+	Height int
+	// Original replaces the uploaded file, it's nil when the upload can be kept as it is
+	Original *Rendition
+	// renditions are nil when the image is already smaller
+	Thumbnail *Rendition
+	Medium    *Rendition
+	BlurHash  string
+}
+
+// CanProcess reports whether Process can decode the content type, only the formats in the standard library are supported
+func CanProcess(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	default:
+		return false
+	}
+}
+
+// Process decodes an image, turns it the right way up and makes its renditions and blurhash.
+// JPEGs and PNGs are re-encoded, which drops their EXIF data, GPS included. GIFs keep their
+// animation so the original is kept, and the renditions are PNGs of the first frame
+func Process(data []byte) (*Result, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "jpeg" {
+		img = Orient(img, Orientation(data))
+	}
+
+	bounds := img.Bounds()
+	result := &Result{Width: bounds.Dx(), Height: bounds.Dy()}
+
+	contentType := "image/png"
+	if format == "jpeg" {
+		contentType = "image/jpeg"
+	}
+
+	if format != "gif" {
+		if result.Original, err = encode(img, contentType); err != nil {
+			return nil, err
+		}
+	}
+
+	if max(result.Width, result.Height) > ThumbnailSize {
+		if result.Thumbnail, err = encode(Resize(img, ThumbnailSize), contentType); err != nil {
+			return nil, err
+		}
+	}
+
+	if max(result.Width, result.Height) > MediumSize {
+		if result.Medium, err = encode(Resize(img, MediumSize), contentType); err != nil {
+			return nil, err
+		}
+	}
+
+	// the hash only keeps a few frequencies, a tiny copy gives the same result much faster
+	result.BlurHash = BlurHash(Resize(img, 32), 4, 3)
+
+	return result, nil
+}
+
+func encode(img image.Image, contentType string) (*Rendition, error) {
+	var buf bytes.Buffer
+
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("can not encode %s", contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	return &Rendition{Data: buf.Bytes(), ContentType: contentType, Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
@@ -0,0 +1,116 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestBlurHash(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xFF
+	}
+
+	// a flat image only has the average colour, every other component is zero
+	expected := "L00000fQfQfQfQfQfQfQfQfQfQfQ"
+	if got := BlurHash(img, 4, 3); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// a 2x1 image, red then blue
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 0xFF, A: 0xFF})
+	img.Set(1, 0, color.RGBA{B: 0xFF, A: 0xFF})
+
+	// a quarter turn clockwise puts red on top
+	rotated := Orient(img, 6)
+	if rotated.Bounds().Dx() != 1 || rotated.Bounds().Dy() != 2 {
+		t.Fatalf("Expected a 1x2 image, got %v", rotated.Bounds())
+	}
+
+	if r, _, _, _ := rotated.At(0, 0).RGBA(); r == 0 {
+		t.Errorf("Expected red at the top, got %v", rotated.At(0, 0))
+	}
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+
+	resized := Resize(img, 100)
+	if resized.Bounds().Dx() != 100 || resized.Bounds().Dy() != 50 {
+		t.Errorf("Expected 100x50, got %v", resized.Bounds())
+	}
+
+	if small := Resize(img, 2000); small != image.Image(img) {
+		t.Error("Expected an image that fits to be returned as it is")
+	}
+}
+
+func TestProcess(t *testing.T) {
+	data := jpegWithOrientation(t, 400, 200, 6)
+
+	if o := Orientation(data); o != 6 {
+		t.Fatalf("Expected orientation 6, got %d", o)
+	}
+
+	result, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should turn the image the right way up", func(t *testing.T) {
+		if result.Width != 200 || result.Height != 400 {
+			t.Errorf("Expected 200x400, got %dx%d", result.Width, result.Height)
+		}
+	})
+
+	t.Run("should strip the EXIF data", func(t *testing.T) {
+		if bytes.Contains(result.Original.Data, []byte("Exif")) || bytes.Contains(result.Original.Data, []byte("GPS")) {
+			t.Error("Expected the EXIF data to be removed")
+		}
+	})
+
+	t.Run("should only make the renditions smaller than the image", func(t *testing.T) {
+		if result.Thumbnail == nil || result.Thumbnail.Height != ThumbnailSize {
+			t.Errorf("Expected a thumbnail %d high, got %+v", ThumbnailSize, result.Thumbnail)
+		}
+
+		if result.Medium != nil {
+			t.Error("Expected no medium rendition for a small image")
+		}
+	})
+}
+
+// jpegWithOrientation encodes a JPEG with an EXIF segment holding the orientation and some fake GPS data
+func jpegWithOrientation(t *testing.T, w, h, orientation int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	tiff := []byte("MM\x00\x2A\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, "GPS 51.5N 0.1W"...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	// straight after the start of image marker
+	return append(append(append([]byte{}, encoded[:2]...), app1...), encoded[2:]...)
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey lets automation act as a user with a limited set of scopes
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"-"` // sha256 hash, the plain key is only shown on creation
+	Scopes     []string   `json:"scopes"`
+	Expiry     time.Time  `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+type APIKeyStore struct {
+	db *sql.DB
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key, scopes, expiry) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, key.Key, pq.Array(key.Scopes), key.Expiry).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetByKey only returns keys which are neither revoked nor expired
+func (s *APIKeyStore) GetByKey(ctx context.Context, key string) (*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, expiry, last_used_at, revoked_at, created_at
+		FROM api_keys WHERE key = $1 AND revoked_at IS NULL AND expiry > NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	k := &APIKey{}
+	err := s.db.QueryRowContext(ctx, query, key).Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.Expiry, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+func (s *APIKeyStore) GetByUserID(ctx context.Context, userID int64) ([]APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, expiry, last_used_at, revoked_at, created_at
+		FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.Expiry, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *APIKeyStore) Revoke(ctx context.Context, keyID, userID int64) error {
+	query := `
+		UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Touch records the key being used, at most once a minute to save writes
+func (s *APIKeyStore) Touch(ctx context.Context, keyID int64) error {
+	query := `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, keyID)
+	return err
+}
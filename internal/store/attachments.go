@@ -0,0 +1,406 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// images wait for the media worker before they can be downloaded, the upload may still hold EXIF data
+const (
+	AttachmentPending    = "pending"
+	AttachmentProcessing = "processing"
+	AttachmentReady      = "ready"
+	AttachmentFailed     = "failed"
+)
+
+// Attachment is a file uploaded to a post, the bytes are kept in the blob store under Key
+type Attachment struct {
+	ID          int64  `json:"id"`
+	PostID      int64  `json:"post_id"`
+	UserID      int64  `json:"user_id"`
+	Key         string `json:"-"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	CreatedAt   string `json:"created_at"`
+	Status      string `json:"status"`
+	// only known for images once they're processed
+	Width      *int                           `json:"width"`
+	Height     *int                           `json:"height"`
+	BlurHash   *string                        `json:"blurhash"`
+	Renditions map[string]AttachmentRendition `json:"renditions"`
+	// signed download link, it expires so it isn't stored
+	URL string `json:"url"`
+	// when a media worker claimed it, the worker only saves its result while the claim is still its own
+	ClaimedAt *time.Time `json:"-"`
+}
+
+// AttachmentRendition is a resized copy of an image attachment, such as its thumbnail
+type AttachmentRendition struct {
+	Key         string `json:"-"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+// attachmentColumns is selected from attachments a, read with scanAttachment
+const attachmentColumns = `a.id, a.post_id, a.user_id, a.key, a.filename, a.content_type, a.size, a.created_at, a.status, a.width, a.height, a.blurhash,
+		(
+			SELECT COALESCE(json_object_agg(r.name, json_build_object('content_type', r.content_type, 'width', r.width, 'height', r.height, 'size', r.size)), '{}')
+			FROM attachment_renditions r WHERE r.attachment_id = a.id
+		) AS renditions`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAttachment(row scanner) (*Attachment, error) {
+	var a Attachment
+	var renditions []byte
+	err := row.Scan(&a.ID, &a.PostID, &a.UserID, &a.Key, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt, &a.Status, &a.Width, &a.Height, &a.BlurHash, &renditions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(renditions, &a.Renditions); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+type AttachmentStore struct {
+	db *sql.DB
+}
+
+// Create adds attachments to their post, all of them or none. It returns ErrTooManyAttachments
+// when the post would have more than limit, the post is locked so uploads can't race past it
+func (s *AttachmentStore) Create(ctx context.Context, limit int, attachments ...*Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		postID := attachments[0].PostID
+		err := tx.QueryRowContext(ctx, `SELECT id FROM posts WHERE id = $1 FOR UPDATE`, postID).Scan(&postID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM attachments WHERE post_id = $1`, postID).Scan(&count); err != nil {
+			return err
+		}
+
+		if count+len(attachments) > limit {
+			return ErrTooManyAttachments
+		}
+
+		query := `
+			INSERT INTO attachments (post_id, user_id, key, filename, content_type, size, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at
+		`
+
+		for _, a := range attachments {
+			if a.Status == "" {
+				a.Status = AttachmentReady
+			}
+
+			a.Renditions = map[string]AttachmentRendition{}
+			err := tx.QueryRowContext(ctx, query, a.PostID, a.UserID, a.Key, a.Filename, a.ContentType, a.Size, a.Status).Scan(&a.ID, &a.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetByID returns ErrNotFound for attachments of posts in the trash
+func (s *AttachmentStore) GetByID(ctx context.Context, id int64) (*Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + ` FROM attachments a
+		JOIN posts p ON p.id = a.post_id
+		WHERE a.id = $1 AND p.deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	a, err := scanAttachment(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// GetByPostID lists a posts attachments in the order they were uploaded
+func (s *AttachmentStore) GetByPostID(ctx context.Context, postID int64) ([]Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + ` FROM attachments a
+		WHERE a.post_id = $1
+		ORDER BY a.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, *a)
+	}
+
+	return attachments, rows.Err()
+}
+
+// GetByPostIDs lists the attachments of several posts at once, for feeds, in the order they were uploaded
+func (s *AttachmentStore) GetByPostIDs(ctx context.Context, postIDs []int64) ([]Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + ` FROM attachments a
+		WHERE a.post_id = ANY($1)
+		ORDER BY a.post_id, a.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, *a)
+	}
+
+	return attachments, rows.Err()
+}
+
+func (s *AttachmentStore) GetRendition(ctx context.Context, attachmentID int64, name string) (*AttachmentRendition, error) {
+	query := `
+		SELECT key, content_type, width, height, size FROM attachment_renditions WHERE attachment_id = $1 AND name = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var r AttachmentRendition
+	err := s.db.QueryRowContext(ctx, query, attachmentID, name).Scan(&r.Key, &r.ContentType, &r.Width, &r.Height, &r.Size)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &r, nil
+}
+
+// Delete removes an attachment and its renditions, it returns their blob keys for the caller to delete
+func (s *AttachmentStore) Delete(ctx context.Context, id int64) ([]string, error) {
+	keys := []string{}
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, `DELETE FROM attachment_renditions WHERE attachment_id = $1 RETURNING key`, id)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return err
+			}
+			keys = append(keys, key)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		var key string
+		if err := tx.QueryRowContext(ctx, `DELETE FROM attachments WHERE id = $1 RETURNING key`, id).Scan(&key); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		keys = append(keys, key)
+
+		return nil
+	})
+
+	return keys, err
+}
+
+// ClaimPending hands up to limit unprocessed attachments to a worker. Attachments claimed longer
+// than stale ago are handed out again, their worker is assumed to have died
+func (s *AttachmentStore) ClaimPending(ctx context.Context, limit int, stale time.Duration) ([]Attachment, error) {
+	query := `
+		WITH claimed AS (
+			SELECT id FROM attachments
+			WHERE status = 'pending' OR (status = 'processing' AND claimed_at < NOW() - $2 * INTERVAL '1 second')
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE attachments a
+		SET status = 'processing', claimed_at = NOW()
+		FROM claimed
+		WHERE a.id = claimed.id
+		RETURNING a.id, a.post_id, a.user_id, a.key, a.filename, a.content_type, a.size, a.claimed_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, stale.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		a := Attachment{Status: AttachmentProcessing}
+		if err := rows.Scan(&a.ID, &a.PostID, &a.UserID, &a.Key, &a.Filename, &a.ContentType, &a.Size, &a.ClaimedAt); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, rows.Err()
+}
+
+// SetProcessed stores what the media worker found out about an image and marks it ready. It returns
+// ErrClaimLost when the claim went stale and was handed to another worker, and ErrNotFound when
+// the attachment was deleted
+func (s *AttachmentStore) SetProcessed(ctx context.Context, a *Attachment) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			UPDATE attachments
+			SET status = 'ready', claimed_at = NULL, content_type = $2, size = $3, width = $4, height = $5, blurhash = $6
+			WHERE id = $1 AND status = 'processing' AND claimed_at = $7
+		`
+
+		res, err := tx.ExecContext(ctx, query, a.ID, a.ContentType, a.Size, a.Width, a.Height, a.BlurHash, a.ClaimedAt)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return lostClaim(ctx, tx, a.ID)
+		}
+
+		for name, r := range a.Renditions {
+			query := `
+				INSERT INTO attachment_renditions (attachment_id, name, key, content_type, width, height, size)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT (attachment_id, name) DO UPDATE
+				SET key = EXCLUDED.key, content_type = EXCLUDED.content_type, width = EXCLUDED.width, height = EXCLUDED.height, size = EXCLUDED.size
+			`
+
+			if _, err := tx.ExecContext(ctx, query, a.ID, name, r.Key, r.ContentType, r.Width, r.Height, r.Size); err != nil {
+				return err
+			}
+		}
+
+		a.Status = AttachmentReady
+		a.ClaimedAt = nil
+		return nil
+	})
+}
+
+// SetFailed marks an image that can't be decoded, like SetProcessed it needs the claim to still hold
+func (s *AttachmentStore) SetFailed(ctx context.Context, a *Attachment) error {
+	query := `
+		UPDATE attachments SET status = 'failed', claimed_at = NULL WHERE id = $1 AND status = 'processing' AND claimed_at = $2
+	`
+
+	if err := execAffectingOne(ctx, s.db, query, a.ID, a.ClaimedAt); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return lostClaim(ctx, s.db, a.ID)
+		}
+		return err
+	}
+
+	a.Status = AttachmentFailed
+	a.ClaimedAt = nil
+	return nil
+}
+
+// queryRower is a *sql.DB or a *sql.Tx
+type queryRower interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}
+
+// lostClaim tells why a worker couldn't save its result, ErrClaimLost when another worker holds
+// the attachment now and ErrNotFound when it was deleted
+func lostClaim(ctx context.Context, db queryRower, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM attachments WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrClaimLost
+	}
+
+	return ErrNotFound
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAttachmentProcessing(t *testing.T) {
+	db := newTestDB(t)
+	attachments := &AttachmentStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	post := createTestPost(t, db, author.ID, "photos", time.Now())
+
+	a := &Attachment{PostID: post.ID, UserID: author.ID, Key: "posts/test/photo", Filename: "photo.jpg", ContentType: "image/jpeg", Size: 100, Status: AttachmentPending}
+	if err := attachments.Create(ctx, 10, a); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := attachments.ClaimPending(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(claimed) != 1 || claimed[0].ID != a.ID {
+		t.Fatalf("Expected attachment %d to be claimed, got %v", a.ID, claimed)
+	}
+
+	t.Run("should not hand out a fresh claim twice", func(t *testing.T) {
+		claimed, err := attachments.ClaimPending(ctx, 10, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(claimed) != 0 {
+			t.Errorf("Expected no attachments, got %d", len(claimed))
+		}
+	})
+
+	t.Run("should not save a result once the claim was handed on", func(t *testing.T) {
+		stale := claimed[0]
+		// another worker took over the stale claim
+		if _, err := db.Exec(`UPDATE attachments SET claimed_at = claimed_at - INTERVAL '1 hour' WHERE id = $1`, a.ID); err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if _, err := db.Exec(`UPDATE attachments SET claimed_at = claimed_at + INTERVAL '1 hour' WHERE id = $1`, a.ID); err != nil {
+				t.Fatal(err)
+			}
+		}()
+
+		if err := attachments.SetProcessed(ctx, &stale); err != ErrClaimLost {
+			t.Errorf("Expected ErrClaimLost processing with a lost claim, got %v", err)
+		}
+
+		if err := attachments.SetFailed(ctx, &stale); err != ErrClaimLost {
+			t.Errorf("Expected ErrClaimLost failing with a lost claim, got %v", err)
+		}
+	})
+
+	t.Run("should store dimensions and renditions", func(t *testing.T) {
+		width, height, hash := 640, 480, "L00000fQfQfQfQfQfQfQfQfQfQfQ"
+		processed := claimed[0]
+		processed.Width, processed.Height, processed.BlurHash = &width, &height, &hash
+		processed.Renditions = map[string]AttachmentRendition{
+			"thumbnail": {Key: processed.Key + "-thumbnail", ContentType: "image/jpeg", Width: 320, Height: 240, Size: 10},
+		}
+
+		if err := attachments.SetProcessed(ctx, &processed); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := attachments.GetByID(ctx, a.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Status != AttachmentReady || got.Width == nil || *got.Width != width || got.Renditions["thumbnail"].Width != 320 {
+			t.Errorf("Expected a ready attachment with its thumbnail, got %+v", got)
+		}
+
+		keys, err := attachments.Delete(ctx, a.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(keys) != 2 {
+			t.Errorf("Expected the original and thumbnail keys, got %v", keys)
+		}
+	})
+
+	t.Run("should tell a deleted attachment from a lost claim", func(t *testing.T) {
+		if err := attachments.SetProcessed(ctx, &claimed[0]); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound processing a deleted attachment, got %v", err)
+		}
+	})
+}
+
+func TestCreateAttachmentsLimit(t *testing.T) {
+	db := newTestDB(t)
+	attachments := &AttachmentStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	post := createTestPost(t, db, author.ID, "photos", time.Now())
+
+	files := func(n int) []*Attachment {
+		files := make([]*Attachment, n)
+		for i := range files {
+			files[i] = &Attachment{PostID: post.ID, UserID: author.ID, Key: fmt.Sprintf("posts/test/%d-%d-%d", post.ID, i, time.Now().UnixNano()), Filename: "file.pdf", ContentType: "application/pdf", Size: 100}
+		}
+		return files
+	}
+
+	if err := attachments.Create(ctx, 3, files(2)...); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should add none of the files past the limit", func(t *testing.T) {
+		if err := attachments.Create(ctx, 3, files(2)...); err != ErrTooManyAttachments {
+			t.Errorf("Expected ErrTooManyAttachments, got %v", err)
+		}
+
+		got, err := attachments.GetByPostID(ctx, post.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != 2 {
+			t.Errorf("Expected the 2 earlier attachments only, got %d", len(got))
+		}
+	})
+
+	t.Run("should fill the post up to the limit", func(t *testing.T) {
+		if err := attachments.Create(ctx, 3, files(1)...); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// BlockedUser is an entry in a users block or mute list
+type BlockedUser struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"user"`
+	CreatedAt string `json:"created_at"`
+}
+
+// notBlocked is a SQL condition that holds when neither user has blocked the other,
+// a and b are column names or placeholders
+func notBlocked(a, b string) string {
+	return `NOT EXISTS (
+		SELECT 1 FROM user_blocks ub WHERE (ub.blocker_id = ` + a + ` AND ub.blocked_id = ` + b + `) OR (ub.blocker_id = ` + b + ` AND ub.blocked_id = ` + a + `)
+	)`
+}
+
+// notMuted holds when muter hasn't muted author
+func notMuted(muter, author string) string {
+	return `NOT EXISTS (SELECT 1 FROM user_mutes um WHERE um.muter_id = ` + muter + ` AND um.muted_id = ` + author + `)`
+}
+
+// BlockStore blocks work both ways, neither user sees or interacts with the other
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block also removes any follows and follow requests between the two users
+func (s *BlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		queries := []string{
+			`INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			`DELETE FROM followers WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)`,
+			`DELETE FROM follow_requests WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)`,
+		}
+
+		for _, query := range queries {
+			ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+			_, err := tx.ExecContext(ctx, query, blockerID, blockedID)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	query := `
+		DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2
+	`
+
+	return execAffectingOne(ctx, s.db, query, blockerID, blockedID)
+}
+
+// IsBlocked reports whether either user has blocked the other
+func (s *BlockStore) IsBlocked(ctx context.Context, a, b int64) (bool, error) {
+	query := `
+		SELECT NOT ` + notBlocked("$1::bigint", "$2::bigint") + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	if err := s.db.QueryRowContext(ctx, query, a, b).Scan(&blocked); err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
+
+// GetBlockedIDs lists everyone the user has blocked or been blocked by
+func (s *BlockStore) GetBlockedIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+		SELECT blocked_id FROM user_blocks WHERE blocker_id = $1
+		UNION
+		SELECT blocker_id FROM user_blocks WHERE blocked_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetByUserID lists who the user has blocked
+func (s *BlockStore) GetByUserID(ctx context.Context, userID int64, pq PaginatedQuery) ([]BlockedUser, error) {
+	query := `
+		SELECT u.id, u.username, b.created_at FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at ` + pq.Sort + `, u.id ` + pq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	return listBlockedUsers(ctx, s.db, query, userID, pq)
+}
+
+// MuteStore mutes are one way, they only hide the muted user from the muters feed
+type MuteStore struct {
+	db *sql.DB
+}
+
+func (s *MuteStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	query := `
+		INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterID, mutedID)
+	return err
+}
+
+func (s *MuteStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	query := `
+		DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2
+	`
+
+	return execAffectingOne(ctx, s.db, query, muterID, mutedID)
+}
+
+func (s *MuteStore) GetByUserID(ctx context.Context, userID int64, pq PaginatedQuery) ([]BlockedUser, error) {
+	query := `
+		SELECT u.id, u.username, m.created_at FROM user_mutes m
+		JOIN users u ON u.id = m.muted_id
+		WHERE m.muter_id = $1
+		ORDER BY m.created_at ` + pq.Sort + `, u.id ` + pq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	return listBlockedUsers(ctx, s.db, query, userID, pq)
+}
+
+func listBlockedUsers(ctx context.Context, db *sql.DB, query string, userID int64, pq PaginatedQuery) ([]BlockedUser, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, userID, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []BlockedUser{}
+	for rows.Next() {
+		var u BlockedUser
+		if err := rows.Scan(&u.UserID, &u.Username, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// execAffectingOne returns ErrNotFound when the statement changes nothing
+func execAffectingOne(ctx context.Context, db *sql.DB, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+// ExploreExpTime outlives the refresh interval, so the lists are only missing
+// when nothing has refreshed them for a while
+const ExploreExpTime = time.Hour
+
+const (
+	explorePostsKey = "explore-posts"
+	trendingTagsKey = "trending-tags"
+)
+
+// ExploreStore holds the precomputed explore feed and trending tags, they're
+// shared by every user and replaced whenever they are recomputed
+type ExploreStore struct {
+	db *redis.Client
+}
+
+func (s *ExploreStore) GetPosts(ctx context.Context) ([]store.PostWithMetaData, error) {
+	var posts []store.PostWithMetaData
+	ok, err := s.get(ctx, explorePostsKey, &posts)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func (s *ExploreStore) SetPosts(ctx context.Context, posts []store.PostWithMetaData) error {
+	return s.set(ctx, explorePostsKey, posts)
+}
+
+func (s *ExploreStore) GetTrendingTags(ctx context.Context) ([]store.TagCount, error) {
+	var tags []store.TagCount
+	ok, err := s.get(ctx, trendingTagsKey, &tags)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (s *ExploreStore) SetTrendingTags(ctx context.Context, tags []store.TagCount) error {
+	return s.set(ctx, trendingTagsKey, tags)
+}
+
+func (s *ExploreStore) get(ctx context.Context, key string, v any) (bool, error) {
+	data, err := s.db.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil // Cache miss
+		}
+		return false, err
+	}
+
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *ExploreStore) set(ctx context.Context, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.db.SetEX(ctx, key, data, ExploreExpTime).Err()
+}
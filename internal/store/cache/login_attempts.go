@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// LoginAttempt counts consecutive failed logins for an account or IP, attempts are counted
+// up front and given back when they succeed or are throttled
+type LoginAttempt struct {
+	Failures    int
+	LastFailure time.Time
+
+	// reservedAt is the last time written by the attempt that returned this, so releasing
+	// it only rolls back the time while no later attempt has replaced it
+	reservedAt time.Time
+}
+
+// releaseLoginAttempt gives back a reserved attempt. The last time goes back to what it was
+// before the attempt, unless a later attempt has written its own since
+var releaseLoginAttempt = redis.NewScript(`
+local n = redis.call('HINCRBY', KEYS[1], 'failures', -1)
+if n <= 0 then
+	redis.call('DEL', KEYS[1])
+elseif redis.call('HGET', KEYS[1], 'last') == ARGV[1] then
+	if ARGV[2] == '' then
+		redis.call('HDEL', KEYS[1], 'last')
+	else
+		redis.call('HSET', KEYS[1], 'last', ARGV[2])
+	end
+end
+return n
+`)
+
+type LoginAttemptStore struct {
+	db *redis.Client
+}
+
+// Attempt counts an attempt before the credentials are checked, so parallel requests each see
+// a different count. It returns the attempts made before this one, the count is forgotten ttl
+// after the last attempt
+func (s *LoginAttemptStore) Attempt(ctx context.Context, key string, ttl time.Duration) (LoginAttempt, error) {
+	cacheKey := fmt.Sprintf("login-attempts-%s", key)
+	now := time.Now()
+
+	var failures *redis.IntCmd
+	var last *redis.StringCmd
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		failures = pipe.HIncrBy(ctx, cacheKey, "failures", 1)
+		last = pipe.HGet(ctx, cacheKey, "last")
+		pipe.HSet(ctx, cacheKey, "last", now.UnixNano())
+		pipe.Expire(ctx, cacheKey, ttl)
+		return nil
+	})
+	// the first attempt has no last field
+	if err != nil && err != redis.Nil {
+		return LoginAttempt{}, err
+	}
+
+	before, err := parseLoginAttempt(map[string]string{
+		"failures": strconv.FormatInt(failures.Val()-1, 10),
+		"last":     last.Val(),
+	})
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	before.reservedAt = time.Unix(0, now.UnixNano())
+	return before, nil
+}
+
+// Release gives back an attempt which turned out not to be a failure, attempt is what
+// Attempt returned so a throttled or successful attempt doesn't push the last failure forward
+func (s *LoginAttemptStore) Release(ctx context.Context, key string, attempt LoginAttempt) error {
+	cacheKey := fmt.Sprintf("login-attempts-%s", key)
+
+	previous := ""
+	if !attempt.LastFailure.IsZero() {
+		previous = strconv.FormatInt(attempt.LastFailure.UnixNano(), 10)
+	}
+
+	// the key expiring in the meantime doesn't leave a negative count behind
+	return releaseLoginAttempt.Run(ctx, s.db, []string{cacheKey}, attempt.reservedAt.UnixNano(), previous).Err()
+}
+
+func (s *LoginAttemptStore) Reset(ctx context.Context, key string) error {
+	cacheKey := fmt.Sprintf("login-attempts-%s", key)
+	return s.db.Del(ctx, cacheKey).Err()
+}
+
+func parseLoginAttempt(data map[string]string) (LoginAttempt, error) {
+	if len(data) == 0 {
+		return LoginAttempt{}, nil // no failures
+	}
+
+	failures, err := strconv.Atoi(data["failures"])
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	if failures <= 0 || data["last"] == "" {
+		return LoginAttempt{}, nil
+	}
+
+	last, err := strconv.ParseInt(data["last"], 10, 64)
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	// attempts counted before last held nanoseconds are in seconds
+	if last < 1e12 {
+		return LoginAttempt{Failures: failures, LastFailure: time.Unix(last, 0)}, nil
+	}
+
+	return LoginAttempt{Failures: failures, LastFailure: time.Unix(0, last)}, nil
+}
+
+// MemoryLoginAttemptStore is used when redis is disabled, counts are per instance
+type MemoryLoginAttemptStore struct {
+	mu        sync.Mutex
+	attempts  map[string]*memoryLoginAttempt
+	lastSweep time.Time
+}
+
+type memoryLoginAttempt struct {
+	LoginAttempt
+	expires time.Time
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{
+		attempts: map[string]*memoryLoginAttempt{},
+	}
+}
+
+func (s *MemoryLoginAttemptStore) Attempt(ctx context.Context, key string, ttl time.Duration) (LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now, ttl)
+
+	a, ok := s.attempts[key]
+	if !ok || now.After(a.expires) {
+		a = &memoryLoginAttempt{}
+		s.attempts[key] = a
+	}
+
+	before := a.LoginAttempt
+	before.reservedAt = now
+	a.Failures++
+	a.LastFailure = now
+	a.expires = now.Add(ttl)
+
+	return before, nil
+}
+
+func (s *MemoryLoginAttemptStore) Release(ctx context.Context, key string, attempt LoginAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+
+	a.Failures--
+	if a.Failures <= 0 {
+		delete(s.attempts, key)
+		return nil
+	}
+
+	if a.LastFailure.Equal(attempt.reservedAt) {
+		a.LastFailure = attempt.LastFailure
+	}
+
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep drops expired entries so the map doesn't grow with every IP seen
+func (s *MemoryLoginAttemptStore) sweep(now time.Time, every time.Duration) {
+	if now.Sub(s.lastSweep) < every {
+		return
+	}
+
+	for key, a := range s.attempts {
+		if now.After(a.expires) {
+			delete(s.attempts, key)
+		}
+	}
+	s.lastSweep = now
+}
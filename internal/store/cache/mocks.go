@@ -2,13 +2,18 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/robertgouveia/social/internal/store"
 )
 
 func NewMockStorage() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:         &MockUserStore{},
+		Revocations:   &MockRevocationStore{},
+		LoginAttempts: NewMemoryLoginAttemptStore(),
+		Timelines:     &MockTimelineStore{},
+		Explore:       &MockExploreStore{},
 	}
 }
 
@@ -22,3 +27,64 @@ func (m MockUserStore) Get(ctx context.Context, id int64) (*store.User, error) {
 func (m MockUserStore) Set(ctx context.Context, user *store.User) error {
 	return nil
 }
+
+type MockRevocationStore struct {
+}
+
+func (m MockRevocationStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	return nil
+}
+
+func (m MockRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return false, nil
+}
+
+func (m MockRevocationStore) RevokeUser(ctx context.Context, userID int64, at time.Time, expiry time.Time) error {
+	return nil
+}
+
+func (m MockRevocationStore) UserRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+type MockTimelineStore struct {
+}
+
+func (m MockTimelineStore) Push(ctx context.Context, userIDs []int64, entry store.TimelineEntry) error {
+	return nil
+}
+
+func (m MockTimelineStore) Get(ctx context.Context, userID int64, before *store.FeedCursor, count int) ([]store.TimelineEntry, bool, error) {
+	return nil, false, nil
+}
+
+func (m MockTimelineStore) Set(ctx context.Context, userID int64, entries []store.TimelineEntry) error {
+	return nil
+}
+
+func (m MockTimelineStore) SetDatabaseOnly(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m MockTimelineStore) Delete(ctx context.Context, userIDs ...int64) error {
+	return nil
+}
+
+type MockExploreStore struct {
+}
+
+func (m MockExploreStore) GetPosts(ctx context.Context) ([]store.PostWithMetaData, error) {
+	return nil, nil
+}
+
+func (m MockExploreStore) SetPosts(ctx context.Context, posts []store.PostWithMetaData) error {
+	return nil
+}
+
+func (m MockExploreStore) GetTrendingTags(ctx context.Context) ([]store.TagCount, error) {
+	return nil, nil
+}
+
+func (m MockExploreStore) SetTrendingTags(ctx context.Context, tags []store.TagCount) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type RevocationStore struct {
+	db *redis.Client
+}
+
+// Revoke keeps the token id around only for as long as the token itself is valid
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	ttl := time.Until(expiry)
+	if ttl <= 0 {
+		return nil // already expired
+	}
+
+	cacheKey := fmt.Sprintf("revoked-token-%s", jti)
+	return s.db.SetEX(ctx, cacheKey, userID, ttl).Err()
+}
+
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	cacheKey := fmt.Sprintf("revoked-token-%s", jti)
+
+	n, err := s.db.Exists(ctx, cacheKey).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (s *RevocationStore) RevokeUser(ctx context.Context, userID int64, at time.Time, expiry time.Time) error {
+	ttl := time.Until(expiry)
+	if ttl <= 0 {
+		return nil
+	}
+
+	cacheKey := fmt.Sprintf("revoked-user-%v", userID)
+	return s.db.SetEX(ctx, cacheKey, at.UnixMicro(), ttl).Err()
+}
+
+func (s *RevocationStore) UserRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	cacheKey := fmt.Sprintf("revoked-user-%v", userID)
+
+	data, err := s.db.Get(ctx, cacheKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	micro, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// revocations from before iat had microseconds were kept in seconds
+	if micro < 1e12 {
+		return time.Unix(micro, 0), nil
+	}
+
+	return time.UnixMicro(micro), nil
+}
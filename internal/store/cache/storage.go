@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/robertgouveia/social/internal/store"
@@ -12,10 +13,42 @@ type Storage struct {
 		Get(context.Context, int64) (*store.User, error)
 		Set(context.Context, *store.User) error
 	}
+
+	Revocations interface {
+		Revoke(context.Context, string, int64, time.Time) error
+		IsRevoked(context.Context, string) (bool, error)
+		RevokeUser(context.Context, int64, time.Time, time.Time) error
+		UserRevokedAt(context.Context, int64) (time.Time, error)
+	}
+
+	LoginAttempts interface {
+		Attempt(context.Context, string, time.Duration) (LoginAttempt, error)
+		Release(context.Context, string, LoginAttempt) error
+		Reset(context.Context, string) error
+	}
+
+	Timelines interface {
+		Push(context.Context, []int64, store.TimelineEntry) error
+		Get(context.Context, int64, *store.FeedCursor, int) ([]store.TimelineEntry, bool, error)
+		Set(context.Context, int64, []store.TimelineEntry) error
+		SetDatabaseOnly(context.Context, int64) error
+		Delete(context.Context, ...int64) error
+	}
+
+	Explore interface {
+		GetPosts(context.Context) ([]store.PostWithMetaData, error)
+		SetPosts(context.Context, []store.PostWithMetaData) error
+		GetTrendingTags(context.Context) ([]store.TagCount, error)
+		SetTrendingTags(context.Context, []store.TagCount) error
+	}
 }
 
 func NewRedisStorage(rdb *redis.Client) Storage {
 	return Storage{
-		Users: &UserStore{db: rdb},
+		Users:         &UserStore{db: rdb},
+		Revocations:   &RevocationStore{db: rdb},
+		LoginAttempts: &LoginAttemptStore{db: rdb},
+		Timelines:     &TimelineStore{db: rdb},
+		Explore:       &ExploreStore{db: rdb},
 	}
 }
@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/robertgouveia/social/internal/store"
+)
+
+const (
+	// TimelineLength caps each timeline, older pages are read from the database
+	TimelineLength = 800
+	// TimelineExpTime isn't extended by new posts, so a timeline is rebuilt at least this often
+	TimelineExpTime = time.Hour * 24
+	// timelineTieAllowance is how many extra entries are read to cover posts made in the same second as the cursor
+	timelineTieAllowance = 20
+)
+
+// a built timeline always holds this member, so a user with nothing to read
+// still has a timeline and a missing key means it has to be built
+const timelineSentinel = "0"
+
+// timelineDatabaseOnly is the only member of the timeline of a user who follows a popular
+// account, those posts aren't fanned out so the feed is read from the database
+const timelineDatabaseOnly = "-1"
+
+var ErrTimelineDatabaseOnly = errors.New("timeline is read from the database")
+
+// pushTimeline only adds to timelines that exist, pushing to a missing one would
+// leave it holding the new post without the posts before it
+var pushTimeline = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+	redis.call('ZREMRANGEBYRANK', KEYS[1], 0, -(tonumber(ARGV[3]) + 1))
+end
+return 0
+`)
+
+// TimelineStore keeps each users home timeline as a sorted set of post ids scored by created_at
+type TimelineStore struct {
+	db *redis.Client
+}
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-%v", userID)
+}
+
+// Push adds a new post to the timelines of the given users
+func (s *TimelineStore) Push(ctx context.Context, userIDs []int64, entry store.TimelineEntry) error {
+	_, err := s.db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range userIDs {
+			pushTimeline.Eval(ctx, pipe, []string{timelineKey(id)}, entry.CreatedAt.Unix(), entry.PostID, TimelineLength)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Get reads up to count entries older than before, newest first. ok is false when
+// the timeline hasn't been built or the page runs past the end of the capped timeline
+func (s *TimelineStore) Get(ctx context.Context, userID int64, before *store.FeedCursor, count int) ([]store.TimelineEntry, bool, error) {
+	max := "+inf"
+	if before != nil {
+		max = strconv.FormatInt(before.CreatedAt.Unix(), 10)
+	}
+
+	key := timelineKey(userID)
+
+	var card *redis.IntCmd
+	var databaseOnly *redis.FloatCmd
+	var members *redis.ZSliceCmd
+	_, err := s.db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		card = pipe.ZCard(ctx, key)
+		databaseOnly = pipe.ZScore(ctx, key, timelineDatabaseOnly)
+		members = pipe.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   max,
+			Count: int64(count + timelineTieAllowance),
+		})
+		return nil
+	})
+	// ZScore reports a missing member as redis.Nil
+	if err != nil && err != redis.Nil {
+		return nil, false, err
+	}
+
+	if card.Val() == 0 {
+		return nil, false, nil // Cache miss
+	}
+
+	if databaseOnly.Err() == nil {
+		return nil, false, ErrTimelineDatabaseOnly
+	}
+
+	entries := []store.TimelineEntry{}
+	for _, z := range members.Val() {
+		if z.Member == timelineSentinel {
+			continue
+		}
+
+		id, err := strconv.ParseInt(z.Member.(string), 10, 64)
+		if err != nil {
+			return nil, false, err
+		}
+
+		e := store.TimelineEntry{PostID: id, CreatedAt: time.Unix(int64(z.Score), 0)}
+		if before != nil && !entryBefore(e, before) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	// redis orders equal scores by member as a string, the feed orders them by id
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].PostID > entries[j].PostID
+		}
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+
+	if len(entries) > count {
+		entries = entries[:count]
+	}
+
+	// a short page of a full timeline means older posts were trimmed off
+	if len(entries) < count && card.Val() >= TimelineLength {
+		return nil, false, nil
+	}
+
+	return entries, true, nil
+}
+
+func entryBefore(e store.TimelineEntry, c *store.FeedCursor) bool {
+	if e.CreatedAt.Unix() == c.CreatedAt.Unix() {
+		return e.PostID < c.ID
+	}
+	return e.CreatedAt.Before(c.CreatedAt)
+}
+
+// Set replaces a users timeline
+func (s *TimelineStore) Set(ctx context.Context, userID int64, entries []store.TimelineEntry) error {
+	key := timelineKey(userID)
+
+	members := []*redis.Z{{Score: 0, Member: timelineSentinel}}
+	for _, e := range entries {
+		members = append(members, &redis.Z{Score: float64(e.CreatedAt.Unix()), Member: e.PostID})
+	}
+
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, TimelineExpTime)
+		return nil
+	})
+
+	return err
+}
+
+// SetDatabaseOnly stops the users timeline being rebuilt until it expires or is deleted,
+// Get returns ErrTimelineDatabaseOnly for it
+func (s *TimelineStore) SetDatabaseOnly(ctx context.Context, userID int64) error {
+	key := timelineKey(userID)
+
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZAdd(ctx, key, &redis.Z{Score: 0, Member: timelineDatabaseOnly})
+		pipe.Expire(ctx, key, TimelineExpTime)
+		return nil
+	})
+
+	return err
+}
+
+// Delete drops the users timelines, they're rebuilt the next time they're read
+func (s *TimelineStore) Delete(ctx context.Context, userIDs ...int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = timelineKey(id)
+	}
+
+	return s.db.Del(ctx, keys...).Err()
+}
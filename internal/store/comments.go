@@ -3,15 +3,24 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 )
 
+// MaxCommentDepth is how deeply replies can nest, top level comments are depth 0
+const MaxCommentDepth = 5
+
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID         int64  `json:"id"`
+	PostID     int64  `json:"post_id"`
+	UserID     int64  `json:"user_id"`
+	ParentID   *int64 `json:"parent_id"`
+	Depth      int    `json:"depth"`
+	Content    string `json:"content"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+	ReplyCount int    `json:"reply_count"`
+	Deleted    bool   `json:"deleted"`
+	User       User   `json:"user"`
 }
 
 type CommentStore struct {
@@ -19,30 +28,130 @@ type CommentStore struct {
 }
 
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if comment.ParentID != nil {
+			depth, err := s.getReplyDepth(ctx, tx, comment)
+			if err != nil {
+				return err
+			}
+			comment.Depth = depth
+		}
+
+		// nothing is inserted when the commenter and the posts author have blocked one another
+		query := `
+			INSERT INTO comments (post_id, user_id, parent_id, depth, content)
+			SELECT $1::bigint, $2::bigint, $3::bigint, $4::int, $5::text
+			WHERE ` + notBlocked("$2::bigint", "(SELECT user_id FROM posts WHERE id = $1)") + `
+			RETURNING id, created_at, updated_at
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.ParentID, comment.Depth, comment.Content).Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrBlocked
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// getReplyDepth checks the parent is on the same post and the reply isn't nested too deeply
+func (s *CommentStore) getReplyDepth(ctx context.Context, tx *sql.Tx, comment *Comment) (int, error) {
 	query := `
-		INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3) RETURNING id, created_at
+		SELECT post_id, depth FROM comments WHERE id = $1 AND deleted_at IS NULL FOR SHARE
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content).Scan(&comment.ID, &comment.CreatedAt)
+	var postID int64
+	var depth int
+	err := tx.QueryRowContext(ctx, query, *comment.ParentID).Scan(&postID, &depth)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
 	}
 
-	return nil
+	if postID != comment.PostID {
+		return 0, ErrNotFound
+	}
+
+	if depth+1 > MaxCommentDepth {
+		return 0, ErrCommentTooDeep
+	}
+
+	return depth + 1, nil
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+func (s *CommentStore) GetByID(ctx context.Context, commentID int64) (*Comment, error) {
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id FROM comments c JOIN users ON users.id = c.user_id WHERE c.post_id = $1 ORDER BY c.created_at DESC
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.depth, c.content, c.created_at, c.updated_at,
+		(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count, c.deleted_at IS NOT NULL, users.username, users.id
+		FROM comments c JOIN users ON users.id = c.user_id WHERE c.id = $1
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	var c Comment
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(&c.ID, &c.PostID, &c.UserID, &c.ParentID, &c.Depth, &c.Content, &c.CreatedAt, &c.UpdatedAt, &c.ReplyCount, &c.Deleted, &c.User.Username, &c.User.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+// GetByPostID lists the top level comments, replies are loaded per comment with GetReplies.
+// Comments by users the viewer has blocked, or been blocked by, are left out
+func (s *CommentStore) GetByPostID(ctx context.Context, postID, viewerID int64, pq PaginatedQuery) ([]Comment, error) {
+	query := `
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.depth, c.content, c.created_at, c.updated_at,
+		(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count, c.deleted_at IS NOT NULL, users.username, users.id
+		FROM comments c JOIN users ON users.id = c.user_id WHERE c.post_id = $1 AND c.parent_id IS NULL AND ` + notBlocked("$4", "c.user_id") + `
+		ORDER BY c.created_at ` + pq.Sort + `, c.id ` + pq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	return s.list(ctx, query, postID, viewerID, pq)
+}
+
+// GetReplies lists the direct replies to a comment
+func (s *CommentStore) GetReplies(ctx context.Context, parentID, viewerID int64, pq PaginatedQuery) ([]Comment, error) {
+	query := `
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.depth, c.content, c.created_at, c.updated_at,
+		(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count, c.deleted_at IS NOT NULL, users.username, users.id
+		FROM comments c JOIN users ON users.id = c.user_id WHERE c.parent_id = $1 AND ` + notBlocked("$4", "c.user_id") + `
+		ORDER BY c.created_at ` + pq.Sort + `, c.id ` + pq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	return s.list(ctx, query, parentID, viewerID, pq)
+}
+
+// list runs a comment query taking an id, limit, offset and the viewers id.
+// id breaks ties between comments made in the same second so pages don't overlap
+func (s *CommentStore) list(ctx context.Context, query string, id, viewerID int64, pq PaginatedQuery) ([]Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, id, pq.Limit, pq.Offset, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -52,12 +161,101 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment
 	for rows.Next() {
 		var c Comment
 		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.ParentID, &c.Depth, &c.Content, &c.CreatedAt, &c.UpdatedAt, &c.ReplyCount, &c.Deleted, &c.User.Username, &c.User.ID)
 		if err != nil {
 			return nil, err
 		}
+
+		// deleted comments are only kept for their replies, they don't show who wrote them
+		if c.Deleted {
+			c.UserID = 0
+			c.User = User{}
+		}
 		comments = append(comments, c)
 	}
 
-	return comments, nil
+	return comments, rows.Err()
+}
+
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `
+		UPDATE comments SET content = $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, comment.Content, comment.ID).Scan(&comment.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a comment. A comment with replies is blanked and kept so the replies stay in
+// their thread, deleting the last reply also removes any deleted comments left empty above it
+func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		// replies share lock their parent, so none can be added once this lock is held
+		var parentID *int64
+		err := tx.QueryRowContext(ctx, `SELECT parent_id FROM comments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, commentID).Scan(&parentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		var hasReplies bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM comments WHERE parent_id = $1)`, commentID).Scan(&hasReplies); err != nil {
+			return err
+		}
+
+		if hasReplies {
+			_, err := tx.ExecContext(ctx, `UPDATE comments SET content = '', deleted_at = NOW() WHERE id = $1`, commentID)
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, commentID); err != nil {
+			return err
+		}
+
+		return s.deleteEmptyParents(ctx, tx, parentID)
+	})
+}
+
+// deleteEmptyParents walks up from parentID removing deleted comments which have no replies left
+func (s *CommentStore) deleteEmptyParents(ctx context.Context, tx *sql.Tx, parentID *int64) error {
+	query := `
+		DELETE FROM comments c
+		WHERE c.id = $1 AND c.deleted_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+		RETURNING c.parent_id
+	`
+
+	for parentID != nil {
+		var next *int64
+		err := tx.QueryRowContext(ctx, query, *parentID).Scan(&next)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil
+			default:
+				return err
+			}
+		}
+		parentID = next
+	}
+
+	return nil
 }
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeleteComment(t *testing.T) {
+	db := newTestDB(t)
+	comments := &CommentStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	post := createTestPost(t, db, author.ID, "thread", time.Now())
+
+	comment := func(t *testing.T, parent *Comment) *Comment {
+		t.Helper()
+
+		c := &Comment{PostID: post.ID, UserID: author.ID, Content: "comment"}
+		if parent != nil {
+			c.ParentID = &parent.ID
+		}
+
+		if err := comments.Create(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}
+
+	exists := func(t *testing.T, c *Comment) bool {
+		t.Helper()
+
+		_, err := comments.GetByID(ctx, c.ID)
+		if err != nil && err != ErrNotFound {
+			t.Fatal(err)
+		}
+
+		return err == nil
+	}
+
+	t.Run("should keep a comment with replies as a blank tombstone", func(t *testing.T) {
+		parent := comment(t, nil)
+		reply := comment(t, parent)
+
+		if err := comments.Delete(ctx, parent.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := comments.GetByID(ctx, parent.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.Deleted || got.Content != "" {
+			t.Errorf("Expected a blank deleted comment, got %+v", got)
+		}
+
+		if !exists(t, reply) {
+			t.Error("Expected the reply to be kept")
+		}
+
+		if err := comments.Delete(ctx, parent.ID); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound deleting a tombstone again, got %v", err)
+		}
+
+		if err := comments.Update(ctx, parent); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound editing a tombstone, got %v", err)
+		}
+
+		if err := comments.Create(ctx, &Comment{PostID: post.ID, UserID: author.ID, ParentID: &parent.ID, Content: "late"}); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound replying to a tombstone, got %v", err)
+		}
+	})
+
+	t.Run("should remove tombstones left without replies", func(t *testing.T) {
+		parent := comment(t, nil)
+		middle := comment(t, parent)
+		reply := comment(t, middle)
+
+		for _, c := range []*Comment{parent, middle, reply} {
+			if err := comments.Delete(ctx, c.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, c := range []*Comment{parent, middle, reply} {
+			if exists(t, c) {
+				t.Errorf("Expected comment %d to be removed", c.ID)
+			}
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// FollowRequest is a pending follow of a private account
+type FollowRequest struct {
+	UserID      int64  `json:"user_id"`
+	RequesterID int64  `json:"requester_id"`
+	CreatedAt   string `json:"created_at"`
+	Requester   User   `json:"requester"`
+}
+
+type FollowRequestStore struct {
+	db *sql.DB
+}
+
+// Create asks userID to approve requesterID as a follower
+func (s *FollowRequestStore) Create(ctx context.Context, requesterID, userID int64) error {
+	query := `
+		INSERT INTO follow_requests (user_id, requester_id)
+		SELECT $1::bigint, $2::bigint WHERE ` + notBlocked("$1::bigint", "$2::bigint") + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrBlocked
+	}
+
+	return nil
+}
+
+// GetByUserID lists the requests waiting on userID
+func (s *FollowRequestStore) GetByUserID(ctx context.Context, userID int64, pq PaginatedQuery) ([]FollowRequest, error) {
+	query := `
+		SELECT r.user_id, r.requester_id, r.created_at, u.id, u.username
+		FROM follow_requests r
+		JOIN users u ON u.id = r.requester_id
+		WHERE r.user_id = $1
+		ORDER BY r.created_at ` + pq.Sort + `, r.requester_id ` + pq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []FollowRequest{}
+	for rows.Next() {
+		var fr FollowRequest
+		if err := rows.Scan(&fr.UserID, &fr.RequesterID, &fr.CreatedAt, &fr.Requester.ID, &fr.Requester.Username); err != nil {
+			return nil, err
+		}
+		requests = append(requests, fr)
+	}
+
+	return requests, rows.Err()
+}
+
+// Approve turns the request into a follow
+func (s *FollowRequestStore) Approve(ctx context.Context, requesterID, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.delete(ctx, tx, requesterID, userID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO followers (user_id, follower_id) VALUES ($1, $2) ON CONFLICT DO NOTHING
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, userID, requesterID)
+		return err
+	})
+}
+
+// Delete rejects a request, or cancels it when the requester calls it
+func (s *FollowRequestStore) Delete(ctx context.Context, requesterID, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.delete(ctx, tx, requesterID, userID)
+	})
+}
+
+func (s *FollowRequestStore) delete(ctx context.Context, tx *sql.Tx, requesterID, userID int64) error {
+	query := `
+		DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func approveAllFollowRequests(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		WITH approved AS (
+			DELETE FROM follow_requests WHERE user_id = $1 RETURNING user_id, requester_id
+		)
+		INSERT INTO followers (user_id, follower_id) SELECT user_id, requester_id FROM approved
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
@@ -13,25 +13,45 @@ type Follower struct {
 	CreatedAt  string `json:"created_at"`
 }
 
+// FollowEntry is a user in a followers or following list. Mutual is between
+// them and the user whose list it is, the other flags are relative to the viewer
+type FollowEntry struct {
+	UserID        int64  `json:"user_id"`
+	Username      string `json:"user"`
+	FollowedAt    string `json:"followed_at"`
+	Mutual        bool   `json:"mutual"`
+	FollowsYou    bool   `json:"follows_you"`
+	FollowedByYou bool   `json:"followed_by_you"`
+}
+
 type FollowerStore struct {
 	db *sql.DB
 }
 
 func (s *FollowerStore) Follow(ctx context.Context, followerID, userID int64) error {
 	query := `
-		INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)	
+		INSERT INTO followers (user_id, follower_id)
+		SELECT $1::bigint, $2::bigint WHERE ` + notBlocked("$1::bigint", "$2::bigint") + `
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
+	res, err := s.db.ExecContext(ctx, query, userID, followerID)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
 			return ErrConflict
 		}
 		return err
 	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrBlocked
+	}
 	return nil
 }
 
@@ -56,3 +76,124 @@ func (s *FollowerStore) Unfollow(ctx context.Context, followerID, userID int64)
 	}
 	return nil
 }
+
+func (s *FollowerStore) IsFollowing(ctx context.Context, followerID, userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var following bool
+	if err := s.db.QueryRowContext(ctx, query, userID, followerID).Scan(&following); err != nil {
+		return false, err
+	}
+
+	return following, nil
+}
+
+// GetFollowers lists the users following userID
+func (s *FollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, pq PaginatedQuery) ([]FollowEntry, error) {
+	query := `
+		SELECT u.id, u.username, f.created_at,
+		EXISTS (SELECT 1 FROM followers m WHERE m.user_id = f.follower_id AND m.follower_id = $1) AS mutual,
+		EXISTS (SELECT 1 FROM followers v WHERE v.user_id = $2 AND v.follower_id = f.follower_id) AS follows_you,
+		EXISTS (SELECT 1 FROM followers v WHERE v.user_id = f.follower_id AND v.follower_id = $2) AS followed_by_you
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1
+		ORDER BY f.created_at ` + pq.Sort + `, u.id ` + pq.Sort + `
+		LIMIT $3 OFFSET $4
+	`
+
+	return s.list(ctx, query, userID, viewerID, pq)
+}
+
+// GetFollowing lists the users userID follows
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, pq PaginatedQuery) ([]FollowEntry, error) {
+	query := `
+		SELECT u.id, u.username, f.created_at,
+		EXISTS (SELECT 1 FROM followers m WHERE m.user_id = $1 AND m.follower_id = f.user_id) AS mutual,
+		EXISTS (SELECT 1 FROM followers v WHERE v.user_id = $2 AND v.follower_id = f.user_id) AS follows_you,
+		EXISTS (SELECT 1 FROM followers v WHERE v.user_id = f.user_id AND v.follower_id = $2) AS followed_by_you
+		FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1
+		ORDER BY f.created_at ` + pq.Sort + `, u.id ` + pq.Sort + `
+		LIMIT $3 OFFSET $4
+	`
+
+	return s.list(ctx, query, userID, viewerID, pq)
+}
+
+func (s *FollowerStore) list(ctx context.Context, query string, userID, viewerID int64, pq PaginatedQuery) ([]FollowEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, viewerID, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []FollowEntry{}
+	for rows.Next() {
+		var e FollowEntry
+		if err := rows.Scan(&e.UserID, &e.Username, &e.FollowedAt, &e.Mutual, &e.FollowsYou, &e.FollowedByYou); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetFollowerIDs lists at most limit followers of a user
+func (s *FollowerStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	query := `
+		SELECT follower_id FROM followers WHERE user_id = $1 LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// FollowsPopular reports whether the user follows anyone with more than threshold followers.
+// Followers are only counted up to the threshold so popular accounts stay cheap to check
+func (s *FollowerStore) FollowsPopular(ctx context.Context, userID int64, threshold int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM followers f WHERE f.follower_id = $1 AND (
+				SELECT COUNT(*) FROM (SELECT 1 FROM followers c WHERE c.user_id = f.user_id LIMIT $2 + 1) counted
+			) > $2
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var popular bool
+	if err := s.db.QueryRowContext(ctx, query, userID, threshold).Scan(&popular); err != nil {
+		return false, err
+	}
+
+	return popular, nil
+}
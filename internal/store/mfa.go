@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// MFA is a users TOTP enrolment, the secret is pending until the first code
+// has been verified and Enabled is set
+type MFA struct {
+	UserID    int64  `json:"user_id"`
+	Secret    string `json:"-"`
+	Enabled   bool   `json:"enabled"`
+	LastStep  int64  `json:"-"`
+	CreatedAt string `json:"created_at"`
+}
+
+type MFAStore struct {
+	db *sql.DB
+}
+
+func (s *MFAStore) Get(ctx context.Context, userID int64) (*MFA, error) {
+	query := `
+		SELECT user_id, secret, enabled, last_step, created_at FROM user_mfa WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	mfa := &MFA{}
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastStep, &mfa.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return mfa, nil
+}
+
+// Enroll stores a pending secret, replacing any earlier unconfirmed one
+func (s *MFAStore) Enroll(ctx context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW() WHERE user_mfa.enabled = FALSE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	// already enabled, it has to be disabled first
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// Enable confirms the enrolment and replaces the recovery codes (hashed)
+func (s *MFAStore) Enable(ctx context.Context, userID int64, step int64, recoveryCodes []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE user_mfa SET enabled = TRUE, last_step = $2 WHERE user_id = $1 AND enabled = FALSE
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID, step)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrNotFound
+		}
+
+		if err := s.deleteRecoveryCodes(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		for _, code := range recoveryCodes {
+			query := `
+				INSERT INTO mfa_recovery_codes (user_id, code) VALUES ($1, $2)
+			`
+
+			if _, err := tx.ExecContext(ctx, query, userID, code); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *MFAStore) Disable(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM user_mfa WHERE user_id = $1
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		return s.deleteRecoveryCodes(ctx, tx, userID)
+	})
+}
+
+// UseStep records a verified time step, returning ErrConflict if the step
+// (or a later one) has already been used
+func (s *MFAStore) UseStep(ctx context.Context, userID int64, step int64) error {
+	query := `
+		UPDATE user_mfa SET last_step = $2 WHERE user_id = $1 AND last_step < $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// UseRecoveryCode spends a (hashed) recovery code
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code = $2 AND used_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MFAStore) deleteRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		DELETE FROM mfa_recovery_codes WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
@@ -8,14 +8,97 @@ import (
 
 func NewMockStore() Storage {
 	return Storage{
-		Posts:     nil,
-		Users:     &MockUserStore{},
-		Comments:  nil,
-		Followers: nil,
-		Roles:     nil,
+		Posts:          &MockPostStore{},
+		Users:          &MockUserStore{},
+		Comments:       &MockCommentStore{},
+		Followers:      &MockFollowerStore{},
+		FollowRequests: &MockFollowRequestStore{},
+		Blocks:         &MockBlockStore{},
+		Roles:          &MockRoleStore{},
+		Revocations:    &MockRevocationStore{},
+		RefreshTokens:  &MockRefreshTokenStore{},
+		APIKeys:        &MockAPIKeyStore{},
+		Attachments:    &MockAttachmentStore{},
+		Reactions:      &MockReactionStore{},
 	}
 }
 
+// MockPostStore every post is a followers only post by another user, which the viewer can't see
+type MockPostStore struct {
+}
+
+func (s *MockPostStore) Create(ctx context.Context, post *Post) error {
+	return nil
+}
+
+func (s *MockPostStore) GetByID(ctx context.Context, postID int64) (*Post, error) {
+	return &Post{ID: postID, UserID: 7, Visibility: VisibilityFollowers, Status: PostStatusPublished}, nil
+}
+
+func (s *MockPostStore) Delete(ctx context.Context, postID, deletedBy int64) error {
+	return nil
+}
+
+func (s *MockPostStore) Restore(ctx context.Context, postID, userID int64, retention time.Duration) error {
+	return nil
+}
+
+func (s *MockPostStore) GetTrash(ctx context.Context, userID int64, retention time.Duration, pq PaginatedQuery) ([]Post, error) {
+	return []Post{}, nil
+}
+
+func (s *MockPostStore) PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int, []string, error) {
+	return 0, []string{}, nil
+}
+
+func (s *MockPostStore) Update(ctx context.Context, post *Post) error {
+	return nil
+}
+
+func (s *MockPostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetaData, error) {
+	return []PostWithMetaData{}, nil
+}
+
+func (s *MockPostStore) GetByUserID(ctx context.Context, userID, viewerID int64, fq PaginatedFeedQuery) ([]PostWithMetaData, error) {
+	return []PostWithMetaData{}, nil
+}
+
+func (s *MockPostStore) IsVisibleTo(ctx context.Context, postID, viewerID int64) (bool, error) {
+	return false, nil
+}
+
+func (s *MockPostStore) Publish(ctx context.Context, post *Post) error {
+	return nil
+}
+
+func (s *MockPostStore) PublishDue(ctx context.Context, limit int) ([]Post, error) {
+	return []Post{}, nil
+}
+
+func (s *MockPostStore) GetDrafts(ctx context.Context, userID int64, pq PaginatedQuery) ([]Post, error) {
+	return []Post{}, nil
+}
+
+func (s *MockPostStore) GetFeedByIDs(ctx context.Context, userID int64, postIDs []int64) ([]PostWithMetaData, error) {
+	return []PostWithMetaData{}, nil
+}
+
+func (s *MockPostStore) GetTimeline(ctx context.Context, userID int64, limit int) ([]TimelineEntry, error) {
+	return []TimelineEntry{}, nil
+}
+
+func (s *MockPostStore) GetExplore(ctx context.Context, window time.Duration, limit int) ([]PostWithMetaData, error) {
+	return []PostWithMetaData{}, nil
+}
+
+func (s *MockPostStore) GetExploreByIDs(ctx context.Context, viewerID int64, postIDs []int64) ([]PostWithMetaData, error) {
+	return []PostWithMetaData{}, nil
+}
+
+func (s *MockPostStore) GetTrendingTags(ctx context.Context, window time.Duration, limit int) ([]TagCount, error) {
+	return []TagCount{}, nil
+}
+
 type MockUserStore struct {
 }
 
@@ -28,7 +111,7 @@ func (s *MockUserStore) update(ctx context.Context, tx *sql.Tx, user *User) erro
 }
 
 func (s *MockUserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
-	return &User{}, nil
+	return &User{ID: userID}, nil
 }
 
 // SQL transaction allow for a reversion if one process fails
@@ -64,3 +147,257 @@ func (s *MockUserStore) delete(ctx context.Context, tx *sql.Tx, userID int64) er
 func (s *MockUserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	return &User{}, nil
 }
+
+func (s *MockUserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, resetExp time.Duration) error {
+	return nil
+}
+
+func (s *MockUserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return nil
+}
+
+func (s *MockUserStore) SetPrivate(ctx context.Context, userID int64, private bool) error {
+	return nil
+}
+
+func (s *MockUserStore) GetProfileStats(ctx context.Context, userID, viewerID int64) (*ProfileStats, error) {
+	return &ProfileStats{}, nil
+}
+
+type MockFollowerStore struct {
+}
+
+func (s *MockFollowerStore) Follow(ctx context.Context, followerID, userID int64) error {
+	return nil
+}
+
+func (s *MockFollowerStore) Unfollow(ctx context.Context, followerID, userID int64) error {
+	return nil
+}
+
+func (s *MockFollowerStore) IsFollowing(ctx context.Context, followerID, userID int64) (bool, error) {
+	return false, nil
+}
+
+func (s *MockFollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, pq PaginatedQuery) ([]FollowEntry, error) {
+	return []FollowEntry{}, nil
+}
+
+func (s *MockFollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, pq PaginatedQuery) ([]FollowEntry, error) {
+	return []FollowEntry{}, nil
+}
+
+func (s *MockFollowerStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (s *MockFollowerStore) FollowsPopular(ctx context.Context, userID int64, threshold int) (bool, error) {
+	return false, nil
+}
+
+type MockFollowRequestStore struct {
+}
+
+func (s *MockFollowRequestStore) Create(ctx context.Context, requesterID, userID int64) error {
+	return nil
+}
+
+func (s *MockFollowRequestStore) GetByUserID(ctx context.Context, userID int64, pq PaginatedQuery) ([]FollowRequest, error) {
+	return []FollowRequest{}, nil
+}
+
+func (s *MockFollowRequestStore) Approve(ctx context.Context, requesterID, userID int64) error {
+	return nil
+}
+
+func (s *MockFollowRequestStore) Delete(ctx context.Context, requesterID, userID int64) error {
+	return nil
+}
+
+type MockRevocationStore struct {
+}
+
+func (s *MockRevocationStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	return nil
+}
+
+func (s *MockRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return false, nil
+}
+
+func (s *MockRevocationStore) RevokeUser(ctx context.Context, userID int64, at time.Time, expiry time.Time) error {
+	return nil
+}
+
+func (s *MockRevocationStore) UserRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (s *MockRevocationStore) PurgeExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+type MockRefreshTokenStore struct {
+}
+
+func (s *MockRefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	return nil
+}
+
+func (s *MockRefreshTokenStore) Rotate(ctx context.Context, token string, next *RefreshToken) error {
+	return ErrNotFound
+}
+
+func (s *MockRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	return nil
+}
+
+func (s *MockRefreshTokenStore) RevokeByToken(ctx context.Context, token string) error {
+	return nil
+}
+
+func (s *MockRefreshTokenStore) RevokeAllForUser(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockBlockStore struct {
+}
+
+func (s *MockBlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return nil
+}
+
+func (s *MockBlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	return nil
+}
+
+func (s *MockBlockStore) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	return false, nil
+}
+
+func (s *MockBlockStore) GetBlockedIDs(ctx context.Context, userID int64) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (s *MockBlockStore) GetByUserID(ctx context.Context, userID int64, pq PaginatedQuery) ([]BlockedUser, error) {
+	return []BlockedUser{}, nil
+}
+
+type MockRoleStore struct {
+}
+
+func (s *MockRoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
+	return &Role{Name: name, Level: 2}, nil
+}
+
+func (s *MockRoleStore) SetRequireMFA(ctx context.Context, name string, require bool) error {
+	return nil
+}
+
+// MockAttachmentStore posts have no attachments
+type MockAttachmentStore struct {
+}
+
+func (s *MockAttachmentStore) Create(ctx context.Context, limit int, attachments ...*Attachment) error {
+	return nil
+}
+
+func (s *MockAttachmentStore) GetByID(ctx context.Context, id int64) (*Attachment, error) {
+	return nil, ErrNotFound
+}
+
+func (s *MockAttachmentStore) GetByPostID(ctx context.Context, postID int64) ([]Attachment, error) {
+	return []Attachment{}, nil
+}
+
+func (s *MockAttachmentStore) GetByPostIDs(ctx context.Context, postIDs []int64) ([]Attachment, error) {
+	return []Attachment{}, nil
+}
+
+func (s *MockAttachmentStore) GetRendition(ctx context.Context, attachmentID int64, name string) (*AttachmentRendition, error) {
+	return nil, ErrNotFound
+}
+
+func (s *MockAttachmentStore) Delete(ctx context.Context, id int64) ([]string, error) {
+	return []string{}, nil
+}
+
+func (s *MockAttachmentStore) ClaimPending(ctx context.Context, limit int, stale time.Duration) ([]Attachment, error) {
+	return []Attachment{}, nil
+}
+
+func (s *MockAttachmentStore) SetProcessed(ctx context.Context, a *Attachment) error {
+	return nil
+}
+
+func (s *MockAttachmentStore) SetFailed(ctx context.Context, a *Attachment) error {
+	return nil
+}
+
+// MockCommentStore every comment is on post 1 and written by another user
+type MockCommentStore struct {
+}
+
+func (s *MockCommentStore) Create(ctx context.Context, comment *Comment) error {
+	return nil
+}
+
+func (s *MockCommentStore) GetByID(ctx context.Context, commentID int64) (*Comment, error) {
+	return &Comment{ID: commentID, PostID: 1, UserID: 7}, nil
+}
+
+func (s *MockCommentStore) GetByPostID(ctx context.Context, postID, viewerID int64, pq PaginatedQuery) ([]Comment, error) {
+	return []Comment{}, nil
+}
+
+func (s *MockCommentStore) GetReplies(ctx context.Context, parentID, viewerID int64, pq PaginatedQuery) ([]Comment, error) {
+	return []Comment{}, nil
+}
+
+func (s *MockCommentStore) Update(ctx context.Context, comment *Comment) error {
+	return nil
+}
+
+func (s *MockCommentStore) Delete(ctx context.Context, commentID int64) error {
+	return nil
+}
+
+// MockReactionStore posts have no reactions
+type MockReactionStore struct {
+}
+
+func (s *MockReactionStore) Add(ctx context.Context, postID, userID int64, kind string) error {
+	return nil
+}
+
+func (s *MockReactionStore) Remove(ctx context.Context, postID, userID int64, kind string) error {
+	return nil
+}
+
+func (s *MockReactionStore) GetCounts(ctx context.Context, postID int64) (map[string]int, error) {
+	return map[string]int{}, nil
+}
+
+// MockAPIKeyStore has no keys
+type MockAPIKeyStore struct {
+}
+
+func (s *MockAPIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	return nil
+}
+
+func (s *MockAPIKeyStore) GetByKey(ctx context.Context, hash string) (*APIKey, error) {
+	return nil, ErrNotFound
+}
+
+func (s *MockAPIKeyStore) GetByUserID(ctx context.Context, userID int64) ([]APIKey, error) {
+	return []APIKey{}, nil
+}
+
+func (s *MockAPIKeyStore) Revoke(ctx context.Context, keyID, userID int64) error {
+	return nil
+}
+
+func (s *MockAPIKeyStore) Touch(ctx context.Context, keyID int64) error {
+	return nil
+}
@@ -1,12 +1,55 @@
 package store
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PaginatedQuery is for plain lists, such as comments
+type PaginatedQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Sort   string `json:"sort" validate:"oneof=asc desc"`
+}
+
+func (pq PaginatedQuery) Parse(r *http.Request) (PaginatedQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return pq, err
+		}
+		pq.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return pq, err
+		}
+		pq.Offset = o
+	}
+
+	sort := qs.Get("sort")
+	if sort != "" {
+		pq.Sort = sort
+	}
+
+	return pq, nil
+}
+
 type PaginatedFeedQuery struct {
 	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
 	Offset int      `json:"offset" validate:"gte=0"`
@@ -15,6 +58,75 @@ type PaginatedFeedQuery struct {
 	Search string   `json:"search" validate:"max=100"`
 	Since  string   `json:"since"`
 	Until  string   `json:"until"`
+	// Cursor replaces Offset when set, offset is only kept for older clients
+	Cursor *FeedCursor `json:"-"`
+}
+
+// FeedCursor is the position of a post in the feed, (created_at, id) is unique
+// so new posts arriving between requests can't shift the page
+type FeedCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+	// Before pages backwards from the post instead of forwards
+	Before bool `json:"b,omitempty"`
+	// Query is the Fingerprint of the query the cursor was made for, a position
+	// is meaningless with another sort or other filters
+	Query string `json:"q"`
+}
+
+// Fingerprint identifies the sort and filters of the query, the limit and offset don't change
+// which posts are in the list so they're left out
+func (fq PaginatedFeedQuery) Fingerprint() string {
+	payload, _ := json.Marshal(struct {
+		Sort   string   `json:"sort"`
+		Tags   []string `json:"tags"`
+		Search string   `json:"search"`
+		Since  string   `json:"since"`
+		Until  string   `json:"until"`
+	}{fq.Sort, fq.Tags, fq.Search, fq.Since, fq.Until})
+
+	sum := sha256.Sum256(payload)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// Encode signs the cursor so clients can't craft their own positions
+func (c FeedCursor) Encode(secret []byte) string {
+	payload, _ := json.Marshal(c)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func DecodeFeedCursor(token string, secret []byte) (*FeedCursor, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c FeedCursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
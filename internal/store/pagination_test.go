@@ -0,0 +1,62 @@
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeedCursor(t *testing.T) {
+	secret := []byte("secret")
+	cursor := FeedCursor{CreatedAt: time.Unix(1700000000, 0).UTC(), ID: 42, Before: true, Query: "query"}
+
+	t.Run("should decode an encoded cursor", func(t *testing.T) {
+		got, err := DecodeFeedCursor(cursor.Encode(secret), secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.CreatedAt.Equal(cursor.CreatedAt) || got.ID != cursor.ID || got.Before != cursor.Before || got.Query != cursor.Query {
+			t.Errorf("Expected %+v, got %+v", cursor, *got)
+		}
+	})
+
+	t.Run("should reject a cursor signed with another secret", func(t *testing.T) {
+		if _, err := DecodeFeedCursor(cursor.Encode([]byte("other")), secret); err != ErrInvalidCursor {
+			t.Errorf("Expected ErrInvalidCursor, got %v", err)
+		}
+	})
+
+	t.Run("should reject a tampered cursor", func(t *testing.T) {
+		forged := FeedCursor{CreatedAt: cursor.CreatedAt, ID: 1}.Encode(secret)
+		token := cursor.Encode(secret)
+
+		// payload of one cursor with the signature of another
+		tampered := forged[:strings.Index(forged, ".")] + token[strings.Index(token, "."):]
+		if _, err := DecodeFeedCursor(tampered, secret); err != ErrInvalidCursor {
+			t.Errorf("Expected ErrInvalidCursor, got %v", err)
+		}
+	})
+
+	t.Run("should fingerprint the sort and filters but not the page", func(t *testing.T) {
+		fq := PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: []string{"go"}}
+
+		page := fq
+		page.Limit, page.Offset = 5, 10
+		if fq.Fingerprint() != page.Fingerprint() {
+			t.Error("Expected the limit and offset to be left out")
+		}
+
+		for _, other := range []PaginatedFeedQuery{
+			{Limit: 20, Sort: "asc", Tags: []string{"go"}},
+			{Limit: 20, Sort: "desc", Tags: []string{"rust"}},
+			{Limit: 20, Sort: "desc", Tags: []string{"go"}, Search: "gopher"},
+			{Limit: 20, Sort: "desc", Tags: []string{"go"}, Since: "2024-01-01 00:00:00"},
+			{Limit: 20, Sort: "desc", Tags: []string{"go"}, Until: "2024-01-01 00:00:00"},
+		} {
+			if fq.Fingerprint() == other.Fingerprint() {
+				t.Errorf("Expected %+v to have another fingerprint", other)
+			}
+		}
+	})
+}
@@ -3,7 +3,9 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -11,7 +13,14 @@ import (
 // allows for merging struct vals
 type PostWithMetaData struct {
 	Post
-	CommentCount int `json:"comments_count"`
+	CommentCount   int            `json:"comments_count"`
+	ReactionCounts map[string]int `json:"reactions_count"`
+}
+
+// TimelineEntry is a post in a precomputed home timeline
+type TimelineEntry struct {
+	PostID    int64
+	CreatedAt time.Time
 }
 
 type Post struct {
@@ -23,9 +32,44 @@ type Post struct {
 	CreatedAt string   `json:"created_at"`
 	UpdatedAt string   `json:"updated_at"`
 	//versioning to stop data race issues
-	Version  int       `json:"version"`
-	Comments []Comment `json:"comments"`
-	User     User      `json:"user"`
+	Version    int    `json:"version"`
+	Visibility string `json:"visibility"`
+	Status     string `json:"status"`
+	// when a scheduled post is published
+	PublishAt *time.Time `json:"publish_at"`
+	// only set for posts in the trash
+	DeletedAt   *time.Time   `json:"deleted_at,omitempty"`
+	Comments    []Comment    `json:"comments"`
+	Attachments []Attachment `json:"attachments"`
+	User        User         `json:"user"`
+	// usernames mentioned in the content, MentionIDs are the ones that exist
+	Mentions   []string `json:"-"`
+	MentionIDs []int64  `json:"-"`
+}
+
+// who can see a post, besides its author
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityMentioned = "mentioned"
+)
+
+// drafts and scheduled posts are only seen by their author until they're published
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
+// isLive is a SQL condition on post p, published and not deleted. Every list of posts other than drafts and the trash needs it
+const isLive = "p.status = 'published' AND p.deleted_at IS NULL"
+
+// visibleTo is a SQL condition that holds when viewer, a column name or placeholder,
+// can see post p under its visibility. It doesn't cover blocks or private accounts
+func visibleTo(viewer string) string {
+	return `(p.visibility = 'public' OR p.user_id = ` + viewer + `
+		OR (p.visibility = 'followers' AND EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = p.user_id AND vf.follower_id = ` + viewer + `))
+		OR (p.visibility = 'mentioned' AND EXISTS (SELECT 1 FROM post_mentions pm WHERE pm.post_id = p.id AND pm.user_id = ` + viewer + `)))`
 }
 
 //following on from data race:
@@ -40,34 +84,80 @@ type PostStore struct {
 
 // Methods
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
+	if post.Visibility == "" {
+		post.Visibility = VisibilityPublic
+	}
+
+	if post.Status == "" {
+		post.Status = PostStatusPublished
+	}
+
 	//query to insert user and get back data to fill memory
 	query := `
-	INSERT INTO posts (content, title, user_id, tags)
-	VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+	INSERT INTO posts (content, title, user_id, tags, visibility, status, publish_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at
 	`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
 
-	//inserting and then filling memory
-	err := s.db.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags)).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+		//inserting and then filling memory
+		err := tx.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags), post.Visibility, post.Status, post.PublishAt).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return s.setMentions(ctx, tx, post)
+	})
+}
+
+// setMentions replaces the posts mentions with the users named in post.Mentions,
+// unknown usernames are ignored
+func (s *PostStore) setMentions(ctx context.Context, tx *sql.Tx, post *Post) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_mentions WHERE post_id = $1`, post.ID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO post_mentions (post_id, user_id)
+		SELECT $1, id FROM users WHERE username = ANY($2) AND id <> $3
+		RETURNING user_id
+	`
+
+	mentions := post.Mentions
+	if mentions == nil {
+		mentions = []string{}
+	}
+
+	rows, err := tx.QueryContext(ctx, query, post.ID, pq.Array(mentions), post.UserID)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	return nil
+	post.MentionIDs = []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		post.MentionIDs = append(post.MentionIDs, id)
+	}
+
+	return rows.Err()
 }
 
 func (s *PostStore) GetByID(ctx context.Context, postID int64) (*Post, error) {
 	query := `
-		SELECT id, user_id, title, content, created_at, updated_at, tags, version FROM posts WHERE id = $1
+		SELECT id, user_id, title, content, created_at, updated_at, tags, version, visibility, status, publish_at FROM posts WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	var post Post
-	err := s.db.QueryRowContext(ctx, query, postID).Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &post.UpdatedAt, pq.Array(&post.Tags), &post.Version)
+	err := s.db.QueryRowContext(ctx, query, postID).Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &post.UpdatedAt, pq.Array(&post.Tags), &post.Version, &post.Visibility, &post.Status, &post.PublishAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -79,44 +169,195 @@ func (s *PostStore) GetByID(ctx context.Context, postID int64) (*Post, error) {
 	return &post, nil
 }
 
-func (s *PostStore) Delete(ctx context.Context, postID int64) error {
+// Delete moves a post to the trash, it's purged once the retention window has passed
+func (s *PostStore) Delete(ctx context.Context, postID, deletedBy int64) error {
+	query := `
+		UPDATE posts SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	return execAffectingOne(ctx, s.db, query, postID, deletedBy)
+}
+
+// Restore takes a post the user deleted themselves out of the trash, as long as it's within the retention window
+func (s *PostStore) Restore(ctx context.Context, postID, userID int64, retention time.Duration) error {
+	query := `
+		UPDATE posts SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_by = $2 AND deleted_at > NOW() - $3 * INTERVAL '1 second'
+	`
+
+	return execAffectingOne(ctx, s.db, query, postID, userID, retention.Seconds())
+}
+
+// GetTrash lists the posts a user deleted that can still be restored, most recently deleted first by default
+func (s *PostStore) GetTrash(ctx context.Context, userID int64, retention time.Duration, page PaginatedQuery) ([]Post, error) {
 	query := `
-		DELETE FROM posts WHERE id = $1
+		SELECT id, user_id, title, content, created_at, updated_at, tags, version, visibility, status, publish_at, deleted_at
+		FROM posts
+		WHERE user_id = $1 AND deleted_by = $1 AND deleted_at > NOW() - $2 * INTERVAL '1 second'
+		ORDER BY deleted_at ` + page.Sort + `, id ` + page.Sort + `
+		LIMIT $3 OFFSET $4
 	`
 
-	//allows for adding a timeout
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	res, err := s.db.ExecContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, userID, retention.Seconds(), page.Limit, page.Offset)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	rows, err := res.RowsAffected()
-	if err != nil {
-		return err
+	trash := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.UpdatedAt, pq.Array(&p.Tags), &p.Version, &p.Visibility, &p.Status, &p.PublishAt, &p.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		trash = append(trash, p)
 	}
 
-	if rows == 0 {
-		return ErrNotFound
-	}
+	return trash, rows.Err()
+}
 
-	return nil
+// PurgeDeleted hard deletes up to limit posts that have been in the trash longer than the
+// retention window, along with their comments. It returns how many posts were purged and the
+// blob keys of their attachments and renditions, which the caller deletes from the blob store
+func (s *PostStore) PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int, []string, error) {
+	var purged int
+	keys := []string{}
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		// another instance purging at the same time takes different posts
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id FROM posts
+			WHERE deleted_at <= NOW() - $1 * INTERVAL '1 second'
+			ORDER BY deleted_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		`, retention.Seconds(), limit)
+		if err != nil {
+			return err
+		}
+
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		// comments don't reference posts with a foreign key, so they don't cascade
+		if _, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE post_id = ANY($1)`, pq.Array(ids)); err != nil {
+			return err
+		}
+
+		attachments, err := tx.QueryContext(ctx, `
+			DELETE FROM attachment_renditions WHERE attachment_id IN (SELECT id FROM attachments WHERE post_id = ANY($1)) RETURNING key
+		`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		for attachments.Next() {
+			var key string
+			if err := attachments.Scan(&key); err != nil {
+				attachments.Close()
+				return err
+			}
+			keys = append(keys, key)
+		}
+		err = attachments.Err()
+		attachments.Close()
+		if err != nil {
+			return err
+		}
+
+		attachments, err = tx.QueryContext(ctx, `DELETE FROM attachments WHERE post_id = ANY($1) RETURNING key`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		for attachments.Next() {
+			var key string
+			if err := attachments.Scan(&key); err != nil {
+				attachments.Close()
+				return err
+			}
+			keys = append(keys, key)
+		}
+		err = attachments.Err()
+		attachments.Close()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+			return err
+		}
+
+		purged = len(ids)
+		return nil
+	})
+
+	return purged, keys, err
 }
 
 func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	query := `
 		UPDATE posts
-		SET title = $1, content = $2, version = version + 1
-		WHERE id = $3 AND version = $4
-		RETURNING version
+		SET title = $1, content = $2, visibility = $3, version = version + 1, updated_at = NOW()
+		WHERE id = $4
+		RETURNING version, updated_at
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		// the version being replaced is kept as a revision, locking it first
+		// means a concurrent edit of the same version gets ErrConflict
+		if err := s.createRevision(ctx, tx, post.ID, post.Version); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowContext(ctx, query, &post.Title, &post.Content, &post.Visibility, &post.ID).Scan(&post.Version, &post.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		// the content may have changed who is mentioned
+		return s.setMentions(ctx, tx, post)
+	})
+}
+
+// Publish publishes a draft or scheduled post now, or schedules it when post.Status is scheduled.
+// Publishing resets created_at so the post goes to the top of feeds. ErrConflict means it's already published
+func (s *PostStore) Publish(ctx context.Context, post *Post) error {
+	query := `
+		UPDATE posts
+		SET status = $1::varchar, publish_at = $2,
+		created_at = CASE WHEN $1::varchar = 'published' THEN NOW() ELSE created_at END
+		WHERE id = $3 AND status <> 'published' AND deleted_at IS NULL
+		RETURNING created_at, ARRAY(SELECT user_id FROM post_mentions WHERE post_id = $3)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, &post.Title, &post.Content, &post.ID, &post.Version).Scan(&post.Version)
+	err := s.db.QueryRowContext(ctx, query, post.Status, post.PublishAt, post.ID).Scan(&post.CreatedAt, pq.Array(&post.MentionIDs))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -129,36 +370,374 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	return nil
 }
 
+// PublishDue publishes up to limit scheduled posts that are due and returns them. Rows locked by
+// another instance publishing at the same time are skipped rather than waited on
+func (s *PostStore) PublishDue(ctx context.Context, limit int) ([]Post, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM posts
+			WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+			ORDER BY publish_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE posts p
+		SET status = 'published', created_at = NOW()
+		FROM due
+		WHERE p.id = due.id
+		RETURNING p.id, p.user_id, p.created_at, p.visibility, p.status, ARRAY(SELECT user_id FROM post_mentions WHERE post_id = p.id)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(&p.ID, &p.UserID, &p.CreatedAt, &p.Visibility, &p.Status, pq.Array(&p.MentionIDs)); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetDrafts lists a users drafts and scheduled posts
+func (s *PostStore) GetDrafts(ctx context.Context, userID int64, page PaginatedQuery) ([]Post, error) {
+	query := `
+		SELECT id, user_id, title, content, created_at, updated_at, tags, version, visibility, status, publish_at
+		FROM posts
+		WHERE user_id = $1 AND status <> 'published' AND deleted_at IS NULL
+		ORDER BY created_at ` + page.Sort + `, id ` + page.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drafts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.UpdatedAt, pq.Array(&p.Tags), &p.Version, &p.Visibility, &p.Status, &p.PublishAt)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, p)
+	}
+
+	return drafts, rows.Err()
+}
+
+func (s *PostStore) createRevision(ctx context.Context, tx *sql.Tx, postID int64, version int) error {
+	var revision PostRevision
+	err := tx.QueryRowContext(ctx, `SELECT id, version, title, content, updated_at FROM posts WHERE id = $1 AND version = $2 AND deleted_at IS NULL FOR UPDATE`, postID, version).
+		Scan(&revision.PostID, &revision.Version, &revision.Title, &revision.Content, &revision.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO post_revisions (post_id, version, title, content, created_at) VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err = tx.ExecContext(ctx, query, revision.PostID, revision.Version, revision.Title, revision.Content, revision.CreatedAt)
+	return err
+}
+
+// IsVisibleTo reports whether the posts visibility lets viewerID see it
+func (s *PostStore) IsVisibleTo(ctx context.Context, postID, viewerID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM posts p WHERE p.id = $1 AND p.deleted_at IS NULL AND ` + visibleTo("$2") + `)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var visible bool
+	if err := s.db.QueryRowContext(ctx, query, postID, viewerID).Scan(&visible); err != nil {
+		return false, err
+	}
+
+	return visible, nil
+}
+
+// GetUserFeed lists the users own posts and the posts of everyone they follow
 func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetaData, error) {
+	// the followers filter is a subquery rather than a join so a post is only returned once
+	authors := "(p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1))" +
+		" AND " + notBlocked("$1", "p.user_id") + " AND " + notMuted("$1", "p.user_id")
+
+	return s.listPosts(ctx, authors, userID, userID, fq)
+}
+
+// GetByUserID lists the posts a user has written that viewerID can see
+func (s *PostStore) GetByUserID(ctx context.Context, userID, viewerID int64, fq PaginatedFeedQuery) ([]PostWithMetaData, error) {
+	return s.listPosts(ctx, "p.user_id = $1", userID, viewerID, fq)
+}
+
+// listPosts applies the feed filters and pagination to the posts matched by authors, which is passed userID as $1.
+// Only posts viewerID can see are listed
+func (s *PostStore) listPosts(ctx context.Context, authors string, userID, viewerID int64, fq PaginatedFeedQuery) ([]PostWithMetaData, error) {
+	// a nil slice is sent as NULL, which would never match
+	tags := fq.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	args := []any{userID, fq.Limit, fq.Offset, fq.Search, pq.Array(tags), fq.Since, fq.Until, viewerID}
+
+	// keyset pagination, the comparison follows the sort and flips when paging backwards
+	sort := fq.Sort
+	keyset := ""
+	if fq.Cursor != nil {
+		backwards := fq.Cursor.Before
+		if backwards {
+			sort = reverseSort(sort)
+		}
+
+		op := "<"
+		if sort == "asc" {
+			op = ">"
+		}
+
+		keyset = "AND (p.created_at, p.id) " + op + " ($9, $10)"
+		args = append(args, fq.Cursor.CreatedAt, fq.Cursor.ID)
+	}
+
 	query := `
-		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username, COUNT(c.id) AS comments_count
-		FROM public.posts p
-		LEFT JOIN comments c ON c.post_id = p.id
-		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-		WHERE f.user_id = $1 AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%'|| $4) AND (p.tags @> $5 OR $5 = '{}')
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
+		SELECT ` + feedColumns + `
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE ` + authors + `
+		AND ` + isLive + ` AND ` + visibleTo("$8") + `
+		AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
+		AND (p.tags @> $5 OR $5 = '{}')
+		AND ($6 = '' OR p.created_at >= $6::timestamp AT TIME ZONE 'UTC')
+		AND ($7 = '' OR p.created_at <= $7::timestamp AT TIME ZONE 'UTC')
+		` + keyset + `
+		ORDER BY p.created_at ` + sort + `, p.id ` + sort + `
 		LIMIT $2 OFFSET $3
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var feed []PostWithMetaData
+	feed, err := scanFeed(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// a backwards page was read in reverse, put it back in the requested order
+	if fq.Cursor != nil && fq.Cursor.Before {
+		for i, j := 0, len(feed)-1; i < j; i, j = i+1, j-1 {
+			feed[i], feed[j] = feed[j], feed[i]
+		}
+	}
+
+	return feed, nil
+}
+
+// GetFeedByIDs loads the posts of a users cached timeline, newest first. Posts deleted, hidden
+// from the user, or by users blocked or muted, since they were added to the timeline are left out
+func (s *PostStore) GetFeedByIDs(ctx context.Context, userID int64, postIDs []int64) ([]PostWithMetaData, error) {
+	query := `
+		SELECT ` + feedColumns + `
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = ANY($1) AND ` + notBlocked("$2", "p.user_id") + ` AND ` + notMuted("$2", "p.user_id") + `
+		AND ` + isLive + ` AND ` + visibleTo("$2") + `
+		ORDER BY p.created_at DESC, p.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFeed(rows)
+}
+
+// GetTimeline lists the newest posts for a users home timeline, it's the
+// same set of posts as GetUserFeed without the metadata
+func (s *PostStore) GetTimeline(ctx context.Context, userID int64, limit int) ([]TimelineEntry, error) {
+	query := `
+		SELECT p.id, p.created_at FROM posts p
+		WHERE (p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1))
+		AND ` + notBlocked("$1", "p.user_id") + ` AND ` + notMuted("$1", "p.user_id") + `
+		AND ` + isLive + ` AND ` + visibleTo("$1") + `
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimelineEntry{}
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// onExplore is a SQL condition that holds for posts p by users u that can be shown on explore
+const onExplore = "u.is_private = FALSE AND p.visibility = 'public' AND " + isLive
+
+// GetExplore ranks recent public posts from everyone by engagement, decayed by age so
+// new posts can overtake older ones with more comments and reactions
+func (s *PostStore) GetExplore(ctx context.Context, window time.Duration, limit int) ([]PostWithMetaData, error) {
+	query := `
+		SELECT ` + feedColumns + `
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.created_at > NOW() - $1 * INTERVAL '1 second' AND ` + onExplore + `
+		ORDER BY (
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) +
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) + 1
+		) / POWER(EXTRACT(EPOCH FROM NOW() - p.created_at) / 3600 + 2, 1.5) DESC, p.id DESC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, window.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFeed(rows)
+}
+
+// GetExploreByIDs reloads a ranked explore list for the viewer, keeping its order. Posts that were
+// deleted or hidden since it was ranked, or by users blocked either way, are left out
+func (s *PostStore) GetExploreByIDs(ctx context.Context, viewerID int64, postIDs []int64) ([]PostWithMetaData, error) {
+	query := `
+		SELECT ` + feedColumns + `
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = ANY($1) AND ` + onExplore + ` AND ` + notBlocked("$2", "p.user_id") + `
+		ORDER BY array_position($1, p.id)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFeed(rows)
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// GetTrendingTags counts how many posts used each tag within the window
+func (s *PostStore) GetTrendingTags(ctx context.Context, window time.Duration, limit int) ([]TagCount, error) {
+	query := `
+		SELECT tag, COUNT(*) AS total FROM posts p
+		JOIN users u ON u.id = p.user_id, unnest(p.tags) AS tag
+		WHERE p.created_at > NOW() - $1 * INTERVAL '1 second' AND u.is_private = FALSE AND p.visibility = 'public' AND ` + isLive + `
+		GROUP BY tag
+		ORDER BY total DESC, tag
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, window.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.Tag, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// feedColumns is selected from posts p joined with users u, read with scanFeed
+const feedColumns = `p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.visibility, u.username,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) AS comments_count,
+		(
+			SELECT COALESCE(json_object_agg(r.kind, r.total), '{}') FROM (
+				SELECT kind, COUNT(*) AS total FROM post_reactions WHERE post_id = p.id GROUP BY kind
+			) r
+		) AS reactions_count`
+
+func scanFeed(rows *sql.Rows) ([]PostWithMetaData, error) {
+	feed := []PostWithMetaData{}
 	for rows.Next() {
 		var post PostWithMetaData
-		err := rows.Scan(&post.ID, &post.User.ID, &post.Title, &post.Content, &post.CreatedAt, &post.Version, pq.Array(&post.Tags), &post.User.Username, &post.CommentCount)
+		var reactions []byte
+		err := rows.Scan(&post.ID, &post.User.ID, &post.Title, &post.Content, &post.CreatedAt, &post.Version, pq.Array(&post.Tags), &post.Visibility, &post.User.Username, &post.CommentCount, &reactions)
 		if err != nil {
 			return nil, err
 		}
+		if err := json.Unmarshal(reactions, &post.ReactionCounts); err != nil {
+			return nil, err
+		}
 		feed = append(feed, post)
 	}
-	return feed, nil
+
+	return feed, rows.Err()
+}
+
+func reverseSort(sort string) string {
+	if sort == "asc" {
+		return "desc"
+	}
+	return "asc"
 }
@@ -0,0 +1,527 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestGetUserFeed(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	followers := &FollowerStore{db}
+	ctx := context.Background()
+
+	me := createTestUser(t, db, "me")
+	friend := createTestUser(t, db, "friend")
+	other := createTestUser(t, db, "other")
+	stranger := createTestUser(t, db, "stranger")
+
+	follow(t, followers, me.ID, friend.ID)
+	follow(t, followers, me.ID, other.ID)
+	// people following me shouldn't put their posts in my feed
+	follow(t, followers, stranger.ID, me.ID)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mine := createTestPost(t, db, me.ID, "mine", base)
+	friends := createTestPost(t, db, friend.ID, "friends", base.Add(time.Hour))
+	others := createTestPost(t, db, other.ID, "others", base.Add(2*time.Hour))
+	createTestPost(t, db, stranger.ID, "strangers", base.Add(3*time.Hour))
+
+	query := PaginatedFeedQuery{Limit: 20, Sort: "desc"}
+
+	t.Run("should only include my posts and posts from people I follow, once each", func(t *testing.T) {
+		feed, err := posts.GetUserFeed(ctx, me.ID, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertFeed(t, feed, others.ID, friends.ID, mine.ID)
+	})
+
+	t.Run("should apply since and until", func(t *testing.T) {
+		q := query
+		q.Since = base.Add(30 * time.Minute).Format(time.DateTime)
+		q.Until = base.Add(90 * time.Minute).Format(time.DateTime)
+
+		feed, err := posts.GetUserFeed(ctx, me.ID, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertFeed(t, feed, friends.ID)
+	})
+
+	t.Run("should page through the feed with cursors", func(t *testing.T) {
+		q := query
+		q.Limit = 2
+
+		first, err := posts.GetUserFeed(ctx, me.ID, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertFeed(t, first, others.ID, friends.ID)
+
+		createdAt, err := time.Parse(time.RFC3339, first[1].CreatedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q.Cursor = &FeedCursor{CreatedAt: createdAt, ID: first[1].ID}
+		second, err := posts.GetUserFeed(ctx, me.ID, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertFeed(t, second, mine.ID)
+
+		// a new post arriving doesn't shift the next page
+		createTestPost(t, db, friend.ID, "new", base.Add(4*time.Hour))
+		again, err := posts.GetUserFeed(ctx, me.ID, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertFeed(t, again, mine.ID)
+	})
+}
+
+func assertFeed(t *testing.T, feed []PostWithMetaData, ids ...int64) {
+	t.Helper()
+
+	if len(feed) != len(ids) {
+		t.Fatalf("Expected %d posts, got %d", len(ids), len(feed))
+	}
+
+	for i, id := range ids {
+		if feed[i].ID != id {
+			t.Errorf("Expected post %d at position %d, got %d", id, i, feed[i].ID)
+		}
+	}
+}
+
+func TestGetUserFeedHidesBlockedAndMuted(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	followers := &FollowerStore{db}
+	blocks := &BlockStore{db}
+	mutes := &MuteStore{db}
+	ctx := context.Background()
+
+	me := createTestUser(t, db, "me")
+	muted := createTestUser(t, db, "muted")
+	blocker := createTestUser(t, db, "blocker")
+
+	follow(t, followers, me.ID, muted.ID)
+	follow(t, followers, me.ID, blocker.ID)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mine := createTestPost(t, db, me.ID, "mine", base)
+	createTestPost(t, db, muted.ID, "muted", base.Add(time.Hour))
+	createTestPost(t, db, blocker.ID, "blocked", base.Add(2*time.Hour))
+
+	if err := mutes.Mute(ctx, me.ID, muted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := blocks.Block(ctx, blocker.ID, me.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := posts.GetUserFeed(ctx, me.ID, PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFeed(t, feed, mine.ID)
+
+	t.Run("should not let a blocked user follow again", func(t *testing.T) {
+		if err := followers.Follow(ctx, me.ID, blocker.ID); err != ErrBlocked {
+			t.Errorf("Expected ErrBlocked, got %v", err)
+		}
+	})
+}
+
+func TestPostVisibility(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	followers := &FollowerStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	follower := createTestUser(t, db, "follower")
+	mentioned := createTestUser(t, db, "mentioned")
+	stranger := createTestUser(t, db, "stranger")
+
+	follow(t, followers, follower.ID, author.ID)
+
+	forFollowers := &Post{UserID: author.ID, Title: "followers", Content: "followers", Visibility: VisibilityFollowers}
+	forMentioned := &Post{UserID: author.ID, Title: "mentioned", Content: "hi", Visibility: VisibilityMentioned, Mentions: []string{mentioned.Username}}
+	for _, post := range []*Post{forFollowers, forMentioned} {
+		if err := posts.Create(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		post    *Post
+		viewer  *User
+		visible bool
+	}{
+		{forFollowers, author, true},
+		{forFollowers, follower, true},
+		{forFollowers, stranger, false},
+		{forMentioned, mentioned, true},
+		{forMentioned, follower, false},
+	}
+
+	for _, c := range cases {
+		visible, err := posts.IsVisibleTo(ctx, c.post.ID, c.viewer.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if visible != c.visible {
+			t.Errorf("Expected %s post visible to %s to be %v", c.post.Visibility, c.viewer.Username, c.visible)
+		}
+	}
+
+	t.Run("should leave hidden posts out of the authors posts", func(t *testing.T) {
+		list, err := posts.GetByUserID(ctx, author.ID, stranger.ID, PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertFeed(t, list)
+	})
+}
+
+func TestPublishDue(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	due := &Post{UserID: author.ID, Title: "due", Content: "due", Status: PostStatusScheduled, PublishAt: &past}
+	later := &Post{UserID: author.ID, Title: "later", Content: "later", Status: PostStatusScheduled, PublishAt: &future}
+	draft := &Post{UserID: author.ID, Title: "draft", Content: "draft", Status: PostStatusDraft}
+	for _, post := range []*Post{due, later, draft} {
+		if err := posts.Create(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := PaginatedFeedQuery{Limit: 20, Sort: "desc"}
+	feed, err := posts.GetUserFeed(ctx, author.ID, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFeed(t, feed)
+
+	published, err := posts.PublishDue(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, p := range published {
+		if p.ID == later.ID || p.ID == draft.ID {
+			t.Errorf("Expected post %d to stay unpublished", p.ID)
+		}
+		found = found || p.ID == due.ID
+	}
+	if !found {
+		t.Errorf("Expected post %d to be published", due.ID)
+	}
+
+	feed, err = posts.GetUserFeed(ctx, author.ID, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFeed(t, feed, due.ID)
+}
+
+func TestUpdateKeepsRevisions(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	revisions := &PostRevisionStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	post := &Post{UserID: author.ID, Title: "first", Content: "first"}
+	if err := posts.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := *post
+	post.Content = "second"
+	if err := posts.Update(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should keep the old version", func(t *testing.T) {
+		revision, err := revisions.GetByVersion(ctx, post.ID, stale.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if revision.Content != "first" {
+			t.Errorf("Expected the old content, got %q", revision.Content)
+		}
+	})
+
+	t.Run("should reject edits of a replaced version", func(t *testing.T) {
+		stale.Content = "third"
+		if err := posts.Update(ctx, &stale); err != ErrConflict {
+			t.Errorf("Expected ErrConflict, got %v", err)
+		}
+	})
+}
+
+func TestTrash(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	admin := createTestUser(t, db, "admin")
+	post := createTestPost(t, db, author.ID, "trashed", time.Now())
+
+	if err := posts.Delete(ctx, post.ID, author.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := posts.GetByID(ctx, post.ID); err != ErrNotFound {
+		t.Errorf("Expected deleted posts to be hidden, got %v", err)
+	}
+
+	if err := posts.Restore(ctx, post.ID, author.ID, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should not let the author restore a post an admin removed", func(t *testing.T) {
+		if err := posts.Delete(ctx, post.ID, admin.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := posts.Restore(ctx, post.ID, author.ID, time.Hour); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("should purge posts past the retention window", func(t *testing.T) {
+		if _, _, err := posts.PurgeDeleted(ctx, 0, 100); err != nil {
+			t.Fatal(err)
+		}
+
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1)`, post.ID).Scan(&exists); err != nil {
+			t.Fatal(err)
+		}
+
+		if exists {
+			t.Error("Expected the post to be purged")
+		}
+	})
+}
+
+func TestSearchSnippetEscapesContent(t *testing.T) {
+	db := newTestDB(t)
+	search := &SearchStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	word := fmt.Sprintf("xsstest%d", time.Now().UnixNano())
+	post := &Post{UserID: author.ID, Title: "snippet", Content: `<img src=x onerror="alert('` + word + `')"> ` + word + ` & more`}
+	err := db.QueryRow(
+		`INSERT INTO posts (title, content, user_id, tags) VALUES ($1, $2, $3, '{}') RETURNING id`,
+		post.Title, post.Content, post.UserID,
+	).Scan(&post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := search.Posts(ctx, author.ID, SearchQuery{Query: word, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+
+	snippet := strings.ReplaceAll(strings.ReplaceAll(results[0].Snippet, "<mark>", ""), "</mark>", "")
+	if strings.ContainsAny(snippet, `<>"'`) || !strings.Contains(snippet, "&lt;img") || !strings.Contains(results[0].Snippet, "<mark>"+word+"</mark>") {
+		t.Errorf("Expected the content to be escaped around the marks, got %q", results[0].Snippet)
+	}
+}
+
+func TestPrivateAccount(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	users := &UserStore{db}
+	followers := &FollowerStore{db}
+	requests := &FollowRequestStore{db}
+	search := &SearchStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	requester := createTestUser(t, db, "requester")
+	stranger := createTestUser(t, db, "stranger")
+
+	if err := users.SetPrivate(ctx, author.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	word := fmt.Sprintf("privatetest%d", time.Now().UnixNano())
+	post := &Post{UserID: author.ID, Title: "private", Content: word, Visibility: VisibilityPublic}
+	if err := posts.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := requests.Create(ctx, requester.ID, author.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should hide the posts from strangers", func(t *testing.T) {
+		results, err := search.Posts(ctx, stranger.ID, SearchQuery{Query: word, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 0 {
+			t.Errorf("Expected no search results, got %d", len(results))
+		}
+
+		explore, err := posts.GetExplore(ctx, time.Hour, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range explore {
+			if p.ID == post.ID {
+				t.Error("Expected the post to be left out of explore")
+			}
+		}
+	})
+
+	t.Run("should not follow until the request is approved", func(t *testing.T) {
+		following, err := followers.IsFollowing(ctx, requester.ID, author.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if following {
+			t.Error("Expected a pending request not to follow")
+		}
+	})
+
+	t.Run("should approve pending requests when going public", func(t *testing.T) {
+		if err := users.SetPrivate(ctx, author.ID, false); err != nil {
+			t.Fatal(err)
+		}
+
+		following, err := followers.IsFollowing(ctx, requester.ID, author.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !following {
+			t.Error("Expected the pending request to be approved")
+		}
+
+		feed, err := posts.GetUserFeed(ctx, requester.ID, PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertFeed(t, feed, post.ID)
+	})
+}
+
+func TestGetExploreByIDs(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	blocks := &BlockStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	blocker := createTestUser(t, db, "blocker")
+	viewer := createTestUser(t, db, "viewer")
+
+	kept := createTestPost(t, db, author.ID, "kept", time.Now())
+	hidden := createTestPost(t, db, author.ID, "hidden", time.Now())
+	trashed := createTestPost(t, db, author.ID, "trashed", time.Now())
+	blocked := createTestPost(t, db, blocker.ID, "blocked", time.Now())
+
+	// ranked before the changes below, the reload should drop what they hide
+	ranked := []int64{trashed.ID, blocked.ID, hidden.ID, kept.ID}
+
+	hidden.Visibility = VisibilityFollowers
+	if err := posts.Update(ctx, hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := posts.Delete(ctx, trashed.ID, author.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := blocks.Block(ctx, blocker.ID, viewer.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	explore, err := posts.GetExploreByIDs(ctx, viewer.ID, ranked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFeed(t, explore, kept.ID)
+}
+
+func TestGetTrendingTags(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	private := createTestUser(t, db, "private")
+	if _, err := db.Exec(`UPDATE users SET is_private = TRUE WHERE id = $1`, private.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// tags unique to this run, so posts left by other tests don't count
+	popular := fmt.Sprintf("popular-%d", time.Now().UnixNano())
+	quiet := fmt.Sprintf("quiet-%d", time.Now().UnixNano())
+
+	tag := func(t *testing.T, post *Post, tags ...string) {
+		t.Helper()
+
+		if _, err := db.Exec(`UPDATE posts SET tags = $1 WHERE id = $2`, pq.Array(tags), post.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tag(t, createTestPost(t, db, author.ID, "one", time.Now()), popular, quiet)
+	tag(t, createTestPost(t, db, author.ID, "two", time.Now()), popular)
+	tag(t, createTestPost(t, db, author.ID, "old", time.Now().Add(-time.Hour*48)), quiet, quiet)
+	tag(t, createTestPost(t, db, private.ID, "private", time.Now()), quiet, quiet)
+
+	trashed := createTestPost(t, db, author.ID, "trashed", time.Now())
+	tag(t, trashed, quiet)
+	if err := posts.Delete(ctx, trashed.ID, author.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := posts.GetTrendingTags(ctx, time.Hour*24, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	for _, tc := range tags {
+		counts[tc.Tag] = tc.Count
+	}
+
+	if counts[popular] != 2 || counts[quiet] != 1 {
+		t.Errorf("Expected 2 %s and 1 %s, got %v and %v", popular, quiet, counts[popular], counts[quiet])
+	}
+}
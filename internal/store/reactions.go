@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ReactionKinds is the fixed set of reactions a post can receive
+var ReactionKinds = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+func IsReactionKind(kind string) bool {
+	for _, k := range ReactionKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Add is idempotent, reacting twice with the same kind keeps a single reaction
+func (s *ReactionStore) Add(ctx context.Context, postID, userID int64, kind string) error {
+	query := `
+		INSERT INTO post_reactions (post_id, user_id, kind) VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, user_id, kind) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, kind)
+	return err
+}
+
+// Remove is idempotent, removing a reaction that doesn't exist is not an error
+func (s *ReactionStore) Remove(ctx context.Context, postID, userID int64, kind string) error {
+	query := `
+		DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND kind = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, kind)
+	return err
+}
+
+func (s *ReactionStore) GetCounts(ctx context.Context, postID int64) (map[string]int, error) {
+	query := `
+		SELECT kind, COUNT(*) FROM post_reactions WHERE post_id = $1 GROUP BY kind
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var kind string
+		var n int
+		if err := rows.Scan(&kind, &n); err != nil {
+			return nil, err
+		}
+		counts[kind] = n
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReactions(t *testing.T) {
+	db := newTestDB(t)
+	reactions := &ReactionStore{db}
+	ctx := context.Background()
+
+	author := createTestUser(t, db, "author")
+	fan := createTestUser(t, db, "fan")
+	post := createTestPost(t, db, author.ID, "reacted", time.Now())
+
+	assertCounts := func(t *testing.T, want map[string]int) {
+		t.Helper()
+
+		got, err := reactions.GetCounts(ctx, post.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("Expected %v and got %v", want, got)
+		}
+
+		for kind, n := range want {
+			if got[kind] != n {
+				t.Errorf("Expected %v and got %v", want, got)
+			}
+		}
+	}
+
+	t.Run("should keep one reaction per user and kind", func(t *testing.T) {
+		for _, r := range []struct {
+			userID int64
+			kind   string
+		}{{fan.ID, "like"}, {fan.ID, "like"}, {fan.ID, "love"}, {author.ID, "like"}} {
+			if err := reactions.Add(ctx, post.ID, r.userID, r.kind); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		assertCounts(t, map[string]int{"like": 2, "love": 1})
+	})
+
+	t.Run("should ignore removing a missing reaction", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if err := reactions.Remove(ctx, post.ID, fan.ID, "like"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		assertCounts(t, map[string]int{"like": 1, "love": 1})
+	})
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RefreshToken is an opaque, single use token which can be exchanged for a new
+// access token. Every rotation inherits the FamilyID of the original login so
+// that a replayed token can revoke the whole chain.
+type RefreshToken struct {
+	ID        int64      `json:"id"`
+	Token     string     `json:"-"` // sha256 hash, the plain token is never stored
+	UserID    int64      `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	MFA       bool       `json:"mfa"` // the session passed a second factor
+	Expiry    time.Time  `json:"expiry"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt string     `json:"created_at"`
+}
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.create(ctx, tx, token)
+	})
+}
+
+func (s *RefreshTokenStore) create(ctx context.Context, tx *sql.Tx, token *RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (token, user_id, family_id, mfa, expiry) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(ctx, query, token.Token, token.UserID, token.FamilyID, token.MFA, token.Expiry).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rotate marks the token as used and stores next in the same family.
+// Presenting a token that has already been used revokes the family and
+// returns ErrTokenReused, next then only carries the owner and family of the
+// reused token.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, token string, next *RefreshToken) error {
+	reused := false
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		current, err := s.getForUpdate(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			return ErrNotFound
+		}
+
+		// the token has been used before, someone is replaying it
+		if current.UsedAt != nil {
+			reused = true
+			next.UserID = current.UserID
+			next.FamilyID = current.FamilyID
+			return s.revokeFamily(ctx, tx, current.FamilyID)
+		}
+
+		if current.Expiry.Before(time.Now()) {
+			return ErrNotFound
+		}
+
+		if err := s.markUsed(ctx, tx, current.ID); err != nil {
+			return err
+		}
+
+		next.UserID = current.UserID
+		next.FamilyID = current.FamilyID
+		next.MFA = current.MFA
+
+		return s.create(ctx, tx, next)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the revocation has to be committed before reporting the reuse
+	if reused {
+		return ErrTokenReused
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) getForUpdate(ctx context.Context, tx *sql.Tx, token string) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, mfa, expiry, used_at, revoked_at, created_at FROM refresh_tokens WHERE token = $1 FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rt := &RefreshToken{}
+	err := tx.QueryRowContext(ctx, query, token).Scan(&rt.ID, &rt.UserID, &rt.FamilyID, &rt.MFA, &rt.Expiry, &rt.UsedAt, &rt.RevokedAt, &rt.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return rt, nil
+}
+
+func (s *RefreshTokenStore) markUsed(ctx context.Context, tx *sql.Tx, id int64) error {
+	query := `
+		UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.revokeFamily(ctx, tx, familyID)
+	})
+}
+
+func (s *RefreshTokenStore) revokeFamily(ctx context.Context, tx *sql.Tx, familyID string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, familyID)
+	return err
+}
+
+// RevokeByToken revokes the family the token belongs to, used on logout
+func (s *RefreshTokenStore) RevokeByToken(ctx context.Context, token string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token = $1) AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, token)
+	return err
+}
+
+func (s *RefreshTokenStore) RevokeAllForUser(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRotateReusedToken(t *testing.T) {
+	db := newTestDB(t)
+	tokens := &RefreshTokenStore{db}
+	ctx := context.Background()
+
+	user := createTestUser(t, db, "refresh")
+
+	first := &RefreshToken{Token: "first-" + user.Username, UserID: user.ID, FamilyID: "family-" + user.Username, Expiry: time.Now().Add(time.Hour)}
+	if err := tokens.Create(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tokens.Rotate(ctx, first.Token, &RefreshToken{Token: "second-" + user.Username, Expiry: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	next := &RefreshToken{Token: "third-" + user.Username, Expiry: time.Now().Add(time.Hour)}
+	if err := tokens.Rotate(ctx, first.Token, next); err != ErrTokenReused {
+		t.Fatalf("Expected ErrTokenReused, got %v", err)
+	}
+
+	if next.UserID != user.ID || next.FamilyID != first.FamilyID {
+		t.Errorf("Expected the reused tokens owner %d, got %d", user.ID, next.UserID)
+	}
+}
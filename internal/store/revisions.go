@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// PostRevision is the title and content of a post at one version
+type PostRevision struct {
+	PostID  int64  `json:"post_id"`
+	Version int    `json:"version"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// when this version was saved
+	CreatedAt string `json:"created_at"`
+}
+
+// revisionsQuery is every version of post $1, the older ones from post_revisions and the current one from the post
+const revisionsQuery = `
+	SELECT post_id, version, title, content, created_at FROM post_revisions WHERE post_id = $1
+	UNION ALL
+	SELECT id, version, title, content, updated_at FROM posts WHERE id = $1 AND deleted_at IS NULL
+`
+
+// PostRevisionStore reads a posts history, revisions are written by PostStore.Update
+type PostRevisionStore struct {
+	db *sql.DB
+}
+
+func (s *PostRevisionStore) GetByPostID(ctx context.Context, postID int64, pq PaginatedQuery) ([]PostRevision, error) {
+	query := `
+		SELECT post_id, version, title, content, created_at FROM (` + revisionsQuery + `) r
+		ORDER BY version ` + pq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var r PostRevision
+		if err := rows.Scan(&r.PostID, &r.Version, &r.Title, &r.Content, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *PostRevisionStore) GetByVersion(ctx context.Context, postID int64, version int) (*PostRevision, error) {
+	query := `
+		SELECT post_id, version, title, content, created_at FROM (` + revisionsQuery + `) r
+		WHERE version = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var r PostRevision
+	err := s.db.QueryRowContext(ctx, query, postID, version).Scan(&r.PostID, &r.Version, &r.Title, &r.Content, &r.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &r, nil
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RevocationStore is the Postgres backed token revocation list, only used
+// when redis is disabled
+type RevocationStore struct {
+	db *sql.DB
+}
+
+// Revoke blacklists a single access token until it would have expired anyway
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expiry) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, jti, userID, expiry)
+	return err
+}
+
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var revoked bool
+	if err := s.db.QueryRowContext(ctx, query, jti).Scan(&revoked); err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// RevokeUser invalidates every token issued to the user up to and including at
+func (s *RevocationStore) RevokeUser(ctx context.Context, userID int64, at time.Time, expiry time.Time) error {
+	query := `
+		INSERT INTO user_token_revocations (user_id, revoked_at, expiry) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_at = EXCLUDED.revoked_at, expiry = EXCLUDED.expiry
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, at, expiry)
+	return err
+}
+
+// UserRevokedAt returns the zero time if the user has not logged out everywhere
+func (s *RevocationStore) UserRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	query := `
+		SELECT revoked_at FROM user_token_revocations WHERE user_id = $1 AND expiry > NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var revokedAt time.Time
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&revokedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, nil
+		default:
+			return time.Time{}, err
+		}
+	}
+
+	return revokedAt, nil
+}
+
+// PurgeExpired removes revocations for tokens which have expired anyway, it returns how many were removed
+func (s *RevocationStore) PurgeExpired(ctx context.Context) (int64, error) {
+	var purged int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		for _, query := range []string{
+			`DELETE FROM revoked_tokens WHERE expiry < NOW()`,
+			`DELETE FROM user_token_revocations WHERE expiry < NOW()`,
+		} {
+			res, err := tx.ExecContext(ctx, query)
+			if err != nil {
+				return err
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			purged += n
+		}
+
+		return nil
+	})
+
+	return purged, err
+}
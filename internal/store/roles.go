@@ -10,6 +10,7 @@ type Role struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Level       int    `json:"level"`
+	RequireMFA  bool   `json:"require_mfa"`
 }
 
 type RoleStore struct {
@@ -18,17 +19,41 @@ type RoleStore struct {
 
 func (s *RoleStore) GetByName(ctx context.Context, role string) (*Role, error) {
 	query := `
-		SELECT id, name, description, level FROM roles WHERE name = $1
+		SELECT id, name, description, level, require_mfa FROM roles WHERE name = $1
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	Role := &Role{}
-	err := s.db.QueryRowContext(ctx, query, role).Scan(&Role.ID, &Role.Name, &Role.Description, &Role.Level)
+	err := s.db.QueryRowContext(ctx, query, role).Scan(&Role.ID, &Role.Name, &Role.Description, &Role.Level, &Role.RequireMFA)
 	if err != nil {
 		return nil, err
 	}
 
 	return Role, nil
 }
+
+func (s *RoleStore) SetRequireMFA(ctx context.Context, role string, require bool) error {
+	query := `
+		UPDATE roles SET require_mfa = $2 WHERE name = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, role, require)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type SearchQuery struct {
+	Query  string `json:"q" validate:"required,max=100"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (sq SearchQuery) Parse(r *http.Request) (SearchQuery, error) {
+	qs := r.URL.Query()
+
+	sq.Query = strings.TrimSpace(qs.Get("q"))
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return sq, err
+		}
+		sq.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return sq, err
+		}
+		sq.Offset = o
+	}
+
+	return sq, nil
+}
+
+type PostSearchResult struct {
+	Post
+	Rank float64 `json:"rank"`
+	// Snippet is the best matching part of the content, HTML escaped so the <mark> tags
+	// wrapped around the matches are the only markup in it
+	Snippet string `json:"snippet"`
+}
+
+type UserSearchResult struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"user"`
+	CreatedAt string `json:"created_at"`
+}
+
+// htmlEscape escapes a text column in SQL, & goes first so the other entities aren't escaped twice
+func htmlEscape(column string) string {
+	return `replace(replace(replace(replace(replace(` + column + `, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+}
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+// Posts takes web search syntax, such as "quoted phrases", or and -excluded words.
+// Posts by private accounts are only matched for the viewers approved to see them
+func (s *SearchStore) Posts(ctx context.Context, viewerID int64, sq SearchQuery) ([]PostSearchResult, error) {
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.visibility, u.username,
+		ts_rank(p.search, q) AS rank,
+		ts_headline('english', ` + htmlEscape("p.content") + `, q, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10') AS snippet
+		FROM posts p
+		JOIN users u ON u.id = p.user_id,
+		websearch_to_tsquery('english', $1) q
+		WHERE p.search @@ q
+		AND ` + notBlocked("$4", "p.user_id") + `
+		AND (u.is_private = FALSE OR p.user_id = $4 OR EXISTS (SELECT 1 FROM followers f WHERE f.user_id = p.user_id AND f.follower_id = $4))
+		AND ` + isLive + ` AND ` + visibleTo("$4") + `
+		ORDER BY rank DESC, p.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, sq.Query, sq.Limit, sq.Offset, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+	for rows.Next() {
+		var p PostSearchResult
+		err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.Version, pq.Array(&p.Tags), &p.Visibility, &p.User.Username, &p.Rank, &p.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		p.User.ID = p.UserID
+		results = append(results, p)
+	}
+
+	return results, rows.Err()
+}
+
+// Users matches usernames starting with the query, closest matches first
+func (s *SearchStore) Users(ctx context.Context, sq SearchQuery) ([]UserSearchResult, error) {
+	query := `
+		SELECT id, username, created_at FROM users
+		WHERE is_active = TRUE AND username ILIKE $1 || '%'
+		ORDER BY similarity(username, $2) DESC, username
+		LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, escapeLike(sq.Query), sq.Query, sq.Limit, sq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []UserSearchResult{}
+	for rows.Next() {
+		var u UserSearchResult
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, u)
+	}
+
+	return results, rows.Err()
+}
+
+// escapeLike stops % and _ in user input acting as wildcards
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -8,11 +8,16 @@ import (
 )
 
 var (
-	ErrNotFound          = errors.New("record not found")
-	ErrConflict          = errors.New("client conflict in versions")
-	QueryTimeoutDuration = time.Second * 5
-	ErrDuplicateEmail    = errors.New("email already exists")
-	ErrDuplicateUsername = errors.New("username already exists")
+	ErrNotFound           = errors.New("record not found")
+	ErrConflict           = errors.New("client conflict in versions")
+	QueryTimeoutDuration  = time.Second * 5
+	ErrDuplicateEmail     = errors.New("email already exists")
+	ErrDuplicateUsername  = errors.New("username already exists")
+	ErrTokenReused        = errors.New("refresh token has already been used")
+	ErrCommentTooDeep     = errors.New("replies can not be nested any deeper")
+	ErrBlocked            = errors.New("user is blocked")
+	ErrTooManyAttachments = errors.New("post has too many attachments")
+	ErrClaimLost          = errors.New("attachment was claimed by another worker")
 )
 
 // Repository Pattern for decoupling
@@ -22,9 +27,22 @@ type Storage struct {
 		//Defining Methods
 		Create(context.Context, *Post) error
 		GetByID(context.Context, int64) (*Post, error)
-		Delete(context.Context, int64) error
+		Delete(context.Context, int64, int64) error
+		Restore(context.Context, int64, int64, time.Duration) error
+		GetTrash(context.Context, int64, time.Duration, PaginatedQuery) ([]Post, error)
+		PurgeDeleted(context.Context, time.Duration, int) (int, []string, error)
 		Update(context.Context, *Post) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetaData, error)
+		GetByUserID(context.Context, int64, int64, PaginatedFeedQuery) ([]PostWithMetaData, error)
+		IsVisibleTo(context.Context, int64, int64) (bool, error)
+		Publish(context.Context, *Post) error
+		PublishDue(context.Context, int) ([]Post, error)
+		GetDrafts(context.Context, int64, PaginatedQuery) ([]Post, error)
+		GetFeedByIDs(context.Context, int64, []int64) ([]PostWithMetaData, error)
+		GetTimeline(context.Context, int64, int) ([]TimelineEntry, error)
+		GetExplore(context.Context, time.Duration, int) ([]PostWithMetaData, error)
+		GetExploreByIDs(context.Context, int64, []int64) ([]PostWithMetaData, error)
+		GetTrendingTags(context.Context, time.Duration, int) ([]TagCount, error)
 	}
 
 	Users interface {
@@ -34,20 +52,116 @@ type Storage struct {
 		Activate(context.Context, string) error
 		Delete(context.Context, int64) error
 		GetByEmail(context.Context, string) (*User, error)
+		CreatePasswordReset(context.Context, int64, string, time.Duration) error
+		ResetPassword(context.Context, string, *User) error
+		GetProfileStats(context.Context, int64, int64) (*ProfileStats, error)
+		SetPrivate(context.Context, int64, bool) error
 	}
 
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)
+		GetByPostID(context.Context, int64, int64, PaginatedQuery) ([]Comment, error)
+		GetReplies(context.Context, int64, int64, PaginatedQuery) ([]Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
+	}
+
+	Attachments interface {
+		Create(context.Context, int, ...*Attachment) error
+		GetByID(context.Context, int64) (*Attachment, error)
+		GetByPostID(context.Context, int64) ([]Attachment, error)
+		GetByPostIDs(context.Context, []int64) ([]Attachment, error)
+		GetRendition(context.Context, int64, string) (*AttachmentRendition, error)
+		Delete(context.Context, int64) ([]string, error)
+		ClaimPending(context.Context, int, time.Duration) ([]Attachment, error)
+		SetProcessed(context.Context, *Attachment) error
+		SetFailed(context.Context, *Attachment) error
+	}
+
+	PostRevisions interface {
+		GetByPostID(context.Context, int64, PaginatedQuery) ([]PostRevision, error)
+		GetByVersion(context.Context, int64, int) (*PostRevision, error)
+	}
+
+	Reactions interface {
+		Add(context.Context, int64, int64, string) error
+		Remove(context.Context, int64, int64, string) error
+		GetCounts(context.Context, int64) (map[string]int, error)
+	}
+
+	Search interface {
+		Posts(context.Context, int64, SearchQuery) ([]PostSearchResult, error)
+		Users(context.Context, SearchQuery) ([]UserSearchResult, error)
 	}
 
 	Followers interface {
 		Follow(context.Context, int64, int64) error
 		Unfollow(context.Context, int64, int64) error
+		IsFollowing(context.Context, int64, int64) (bool, error)
+		GetFollowers(context.Context, int64, int64, PaginatedQuery) ([]FollowEntry, error)
+		GetFollowing(context.Context, int64, int64, PaginatedQuery) ([]FollowEntry, error)
+		GetFollowerIDs(context.Context, int64, int) ([]int64, error)
+		FollowsPopular(context.Context, int64, int) (bool, error)
+	}
+
+	FollowRequests interface {
+		Create(context.Context, int64, int64) error
+		GetByUserID(context.Context, int64, PaginatedQuery) ([]FollowRequest, error)
+		Approve(context.Context, int64, int64) error
+		Delete(context.Context, int64, int64) error
+	}
+
+	Blocks interface {
+		Block(context.Context, int64, int64) error
+		Unblock(context.Context, int64, int64) error
+		IsBlocked(context.Context, int64, int64) (bool, error)
+		GetBlockedIDs(context.Context, int64) ([]int64, error)
+		GetByUserID(context.Context, int64, PaginatedQuery) ([]BlockedUser, error)
+	}
+
+	Mutes interface {
+		Mute(context.Context, int64, int64) error
+		Unmute(context.Context, int64, int64) error
+		GetByUserID(context.Context, int64, PaginatedQuery) ([]BlockedUser, error)
 	}
 
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
+		SetRequireMFA(context.Context, string, bool) error
+	}
+
+	RefreshTokens interface {
+		Create(context.Context, *RefreshToken) error
+		Rotate(context.Context, string, *RefreshToken) error
+		RevokeFamily(context.Context, string) error
+		RevokeByToken(context.Context, string) error
+		RevokeAllForUser(context.Context, int64) error
+	}
+
+	Revocations interface {
+		Revoke(context.Context, string, int64, time.Time) error
+		IsRevoked(context.Context, string) (bool, error)
+		RevokeUser(context.Context, int64, time.Time, time.Time) error
+		UserRevokedAt(context.Context, int64) (time.Time, error)
+		PurgeExpired(context.Context) (int64, error)
+	}
+
+	MFA interface {
+		Get(context.Context, int64) (*MFA, error)
+		Enroll(context.Context, int64, string) error
+		Enable(context.Context, int64, int64, []string) error
+		Disable(context.Context, int64) error
+		UseStep(context.Context, int64, int64) error
+		UseRecoveryCode(context.Context, int64, string) error
+	}
+
+	APIKeys interface {
+		Create(context.Context, *APIKey) error
+		GetByKey(context.Context, string) (*APIKey, error)
+		GetByUserID(context.Context, int64) ([]APIKey, error)
+		Revoke(context.Context, int64, int64) error
+		Touch(context.Context, int64) error
 	}
 }
 
@@ -55,11 +169,22 @@ type Storage struct {
 func NewStorage(db *sql.DB) Storage {
 	//Creating and returning a Storage object with Repository References
 	return Storage{
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		Comments:  &CommentStore{db},
-		Followers: &FollowerStore{db},
-		Roles:     &RoleStore{db},
+		Posts:          &PostStore{db},
+		Users:          &UserStore{db},
+		Comments:       &CommentStore{db},
+		Followers:      &FollowerStore{db},
+		FollowRequests: &FollowRequestStore{db},
+		Blocks:         &BlockStore{db},
+		Mutes:          &MuteStore{db},
+		PostRevisions:  &PostRevisionStore{db},
+		Attachments:    &AttachmentStore{db},
+		Reactions:      &ReactionStore{db},
+		Search:         &SearchStore{db},
+		Roles:          &RoleStore{db},
+		RefreshTokens:  &RefreshTokenStore{db},
+		Revocations:    &RevocationStore{db},
+		MFA:            &MFAStore{db},
+		APIKeys:        &APIKeyStore{db},
 	}
 }
 
@@ -17,6 +17,7 @@ type User struct {
 	Password  password `json:"-"` //not marshalling password
 	CreatedAt string   `json:"create_at"`
 	IsActive  bool     `json:"is_active"`
+	IsPrivate bool     `json:"is_private"` // posts are only shown to approved followers
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
 }
@@ -38,6 +39,11 @@ func (p *password) Set(text string) error {
 	return nil
 }
 
+// Compare checks a plain text password against the stored hash
+func (p *password) Compare(text string) error {
+	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
+}
+
 type UserStore struct {
 	db *sql.DB
 }
@@ -89,11 +95,11 @@ func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT users.id, users.username, users.email, users.password, users.created_at, roles.* FROM users JOIN roles ON (users.role_id = roles.id) WHERE users.id = $1 AND is_active = TRUE
+		SELECT users.id, users.username, users.email, users.password, users.created_at, users.is_private, roles.id, roles.name, roles.level, roles.description, roles.require_mfa FROM users JOIN roles ON (users.role_id = roles.id) WHERE users.id = $1 AND is_active = TRUE
 	`
 
 	user := &User{}
-	err := s.db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.Role.ID, &user.Role.Name, &user.Role.Level, &user.Role.Description)
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.IsPrivate, &user.Role.ID, &user.Role.Name, &user.Role.Level, &user.Role.Description, &user.Role.RequireMFA)
 
 	if err != nil {
 		switch err {
@@ -232,13 +238,13 @@ func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, userID int64) error
 }
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
-	query := `SELECT id, username, email, password, created_at FROM users WHERE email = $1 AND is_active = TRUE`
+	query := `SELECT users.id, users.username, users.email, users.password, users.created_at, users.is_private, roles.id, roles.name, roles.level, roles.description, roles.require_mfa FROM users JOIN roles ON (users.role_id = roles.id) WHERE email = $1 AND is_active = TRUE`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	var user User
-	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt)
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.IsPrivate, &user.Role.ID, &user.Role.Name, &user.Role.Level, &user.Role.Description, &user.Role.RequireMFA)
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -250,3 +256,173 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 
 	return &user, nil
 }
+
+// CreatePasswordReset replaces any outstanding reset token for the user
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, resetExp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deletePasswordResets(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3)
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(resetExp))
+		return err
+	})
+}
+
+// ResetPassword sets the password hash held by user on the owner of the token,
+// filling in the rest of user
+func (s *UserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// find token (get userID)
+		u, err := s.getUserFromPasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+
+		u.Password = user.Password
+		*user = *u
+
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+		// tokens are single use
+		if err := s.deletePasswordResets(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *UserStore) getUserFromPasswordReset(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active, u.role_id FROM users u JOIN password_resets pr ON u.id = pr.user_id WHERE pr.token = $1 AND pr.expiry > $2
+	`
+
+	tokenByte := sha256.Sum256([]byte(token))
+	tokenHash := hex.EncodeToString(tokenByte[:])
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive, &user.RoleID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `
+		UPDATE users SET password = $1 WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, user.Password.hash, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		DELETE FROM password_resets WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UserProfile is a user with their profile stats merged in
+type UserProfile struct {
+	User
+	ProfileStats
+}
+
+type ProfileStats struct {
+	PostsCount     int  `json:"posts_count"`
+	FollowersCount int  `json:"followers_count"`
+	FollowingCount int  `json:"following_count"`
+	IsFollowing    bool `json:"is_following"` // the viewer follows the user
+	FollowsYou     bool `json:"follows_you"`  // the user follows the viewer
+}
+
+// GetProfileStats counts a users posts and follows, as seen by viewerID
+func (s *UserStore) GetProfileStats(ctx context.Context, userID, viewerID int64) (*ProfileStats, error) {
+	query := `
+		SELECT
+		(SELECT COUNT(*) FROM posts WHERE user_id = $1 AND status = 'published' AND deleted_at IS NULL),
+		(SELECT COUNT(*) FROM followers WHERE user_id = $1),
+		(SELECT COUNT(*) FROM followers WHERE follower_id = $1),
+		EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2),
+		EXISTS (SELECT 1 FROM followers WHERE user_id = $2 AND follower_id = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	stats := &ProfileStats{}
+	err := s.db.QueryRowContext(ctx, query, userID, viewerID).Scan(&stats.PostsCount, &stats.FollowersCount, &stats.FollowingCount, &stats.IsFollowing, &stats.FollowsYou)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// SetPrivate changes who can see a users posts. Going public approves every pending follow request
+func (s *UserStore) SetPrivate(ctx context.Context, userID int64, private bool) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users SET is_private = $1 WHERE id = $2
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, private, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		if private {
+			return nil
+		}
+
+		return approveAllFollowRequests(ctx, tx, userID)
+	})
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestResetPassword(t *testing.T) {
+	db := newTestDB(t)
+	users := &UserStore{db}
+	ctx := context.Background()
+
+	user := createTestUser(t, db, "reset")
+
+	hashToken := func(token string) string {
+		hash := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(hash[:])
+	}
+
+	if err := users.CreatePasswordReset(ctx, user.ID, hashToken("token"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	reset := &User{}
+	if err := reset.Password.Set("newpassword"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := users.ResetPassword(ctx, "token", reset); err != nil {
+		t.Fatal(err)
+	}
+
+	if reset.ID != user.ID {
+		t.Errorf("Expected the reset to fill in user %d, got %d", user.ID, reset.ID)
+	}
+
+	got, err := users.GetByEmail(ctx, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := got.Password.Compare("newpassword"); err != nil {
+		t.Errorf("Expected the new password to be stored, got %v", err)
+	}
+
+	t.Run("should only use a token once", func(t *testing.T) {
+		if err := users.ResetPassword(ctx, "token", reset); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("should reject an expired token", func(t *testing.T) {
+		if err := users.CreatePasswordReset(ctx, user.ID, hashToken("expired"), -time.Minute); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := users.ResetPassword(ctx, "expired", reset); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+}